@@ -1,21 +1,314 @@
 package config
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
 // Secrets defined for the application
 // All fields default to empty strings if not set via Encore secrets
 var secrets struct {
-	GroqAPIKey       string // API key for Groq service (defaults to "")
-	OpenRouterAPIKey string // API key for OpenRouter service (defaults to "")
-	GeminiAPIKey     string // API key for Gemini service (defaults to "")
-	AtlasAPIKey      string // API key for Atlas service (defaults to "")
-	ChutesAPIKey     string // API key for Chutes service (defaults to "")
+	GroqAPIKey         string // API key for Groq service (defaults to "")
+	OpenRouterAPIKey   string // API key for OpenRouter service (defaults to "")
+	GeminiAPIKey       string // API key for Gemini service (defaults to "")
+	AtlasAPIKey        string // API key for Atlas service (defaults to "")
+	ChutesAPIKey       string // API key for Chutes service (defaults to "")
+	CustomProviderKeys string // JSON object mapping custom provider secret names to API keys (defaults to "")
+	GatewayAdminKey    string // Bootstrap gateway key with the admin scope, used to issue the first keys (defaults to "")
+}
+
+// ConfigFileEnv is the environment variable pointing to the gateway configuration file
+const ConfigFileEnv = "GATEWAY_CONFIG_FILE"
+
+// AuthSchemeNone marks a custom provider that is called without an API key
+const AuthSchemeNone = "none"
+
+// builtinProviders lists the providers that are implemented in code
+var builtinProviders = []string{"groq", "openrouter", "gemini", "atlas", "chutes"}
+
+// CustomProvider describes an OpenAI-compatible endpoint registered from configuration
+type CustomProvider struct {
+	Name               string            `json:"name"`
+	BaseURL            string            `json:"base_url"`
+	SecretName         string            `json:"secret_name,omitempty"`
+	DefaultModel       string            `json:"default_model"`
+	DefaultVisionModel string            `json:"default_vision_model,omitempty"`
+	Headers            map[string]string `json:"headers,omitempty"`
+	AuthScheme         string            `json:"auth_scheme,omitempty"`        // bearer (default), header or none
+	AuthHeader         string            `json:"auth_header,omitempty"`        // header name used with the header auth scheme
+	Models             []ModelSpec       `json:"models,omitempty"`             // Static model catalog
+	UnsupportedParams  []string          `json:"unsupported_params,omitempty"` // Request parameters the endpoint lacks, defaults to ["top_k"]
+
+	DefaultEmbeddingModel string `json:"default_embedding_model,omitempty"` // Enables /v1/embeddings on this endpoint
+	EmbeddingBatchSize    int    `json:"embedding_batch_size,omitempty"`    // Inputs per upstream embeddings call
+}
+
+// ModelSpec describes a model in a custom provider's catalog
+type ModelSpec struct {
+	ID            string   `json:"id"`
+	ContextWindow int      `json:"context_window,omitempty"`
+	Vision        bool     `json:"vision,omitempty"`
+	Tools         bool     `json:"tools,omitempty"`
+	InputPrice    *float64 `json:"input_price,omitempty"`  // USD per million prompt tokens
+	OutputPrice   *float64 `json:"output_price,omitempty"` // USD per million completion tokens
+}
+
+// FallbackConfig configures the provider fallback chain
+type FallbackConfig struct {
+	Providers []string                     `json:"providers"`           // Providers tried in order when a request names none
+	ModelMap  map[string]map[string]string `json:"model_map,omitempty"` // Requested model -> provider -> model to use on that provider
+}
+
+// RouterConfig configures how the model of a request picks its provider
+type RouterConfig struct {
+	Aliases map[string][]string `json:"aliases,omitempty"` // Alias -> "provider/model" targets tried in order
+}
+
+// RetryConfig configures retries of failed upstream calls, zero values mean the built-in default
+type RetryConfig struct {
+	MaxAttempts int                    `json:"max_attempts,omitempty"`  // Total attempts including the first one
+	BaseDelayMs int                    `json:"base_delay_ms,omitempty"` // Backoff before the first retry, doubled on each further retry
+	MaxDelayMs  int                    `json:"max_delay_ms,omitempty"`  // Upper bound for a single backoff
+	Providers   map[string]RetryConfig `json:"providers,omitempty"`     // Per-provider overrides
+}
+
+// CircuitBreakerConfig configures the per-provider circuit breakers, zero values mean the built-in default
+type CircuitBreakerConfig struct {
+	FailureThreshold int `json:"failure_threshold,omitempty"` // Consecutive failures that open the breaker
+	CooldownMs       int `json:"cooldown_ms,omitempty"`       // Time an open breaker waits before letting a trial call through
+}
+
+// RateLimit configures a requests and tokens per minute limit, zero values mean unlimited
+type RateLimit struct {
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	TokensPerMinute   int `json:"tokens_per_minute,omitempty"` // Prompt plus completion tokens
+}
+
+// RateLimitConfig configures the rate limits of gateway keys and upstream provider keys
+type RateLimitConfig struct {
+	Key       RateLimit            `json:"key"`                 // Default limit of every gateway key
+	Providers map[string]RateLimit `json:"providers,omitempty"` // Limit of each provider's upstream key
+}
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `json:"input"`  // Per million prompt tokens
+	Output float64 `json:"output"` // Per million completion tokens
+}
+
+// RequestLogConfig configures the request log
+type RequestLogConfig struct {
+	StoreBodies bool `json:"store_bodies,omitempty"` // Also store prompts and responses, off by default
+}
+
+// BudgetConfig configures the budgets of gateway keys, zero values mean the built-in default
+type BudgetConfig struct {
+	WarnThreshold float64 `json:"warn_threshold,omitempty"` // Share of a budget that triggers a warning, 0.8 by default
+}
+
+// ResponseCacheConfig configures the exact-match response cache, zero values mean the built-in default
+type ResponseCacheConfig struct {
+	Enabled    bool `json:"enabled,omitempty"`
+	TTLSeconds int  `json:"ttl_seconds,omitempty"` // Lifetime of a cached response, 1 hour by default
+	InMemory   bool `json:"in_memory,omitempty"`   // Keep responses in process memory instead of Encore's cache, e.g. for tests
+}
+
+// SemanticCacheConfig configures the semantic response cache, zero values mean the built-in default
+type SemanticCacheConfig struct {
+	Enabled    bool    `json:"enabled,omitempty"`
+	Model      string  `json:"model,omitempty"`       // Embedding model, the first provider able to embed by default
+	Threshold  float64 `json:"threshold,omitempty"`   // Minimum cosine similarity of a hit, 0.95 by default
+	TTLSeconds int     `json:"ttl_seconds,omitempty"` // Lifetime of a cached response, 1 hour by default
+	MaxEntries int     `json:"max_entries,omitempty"` // Responses kept before the oldest are evicted, 10000 by default
 }
 
 // Config holds application configuration
-type Config struct{}
+type Config struct {
+	CustomProviders []CustomProvider
+	Fallback        FallbackConfig
+	Router          RouterConfig
+	Retry           RetryConfig
+	CircuitBreaker  CircuitBreakerConfig
+	RateLimits      RateLimitConfig
+	RequestLog      RequestLogConfig
+	Pricing         map[string]ModelPrice
+	Budgets         BudgetConfig
+	ResponseCache   ResponseCacheConfig
+	SemanticCache   SemanticCacheConfig
+
+	customKeys map[string]string
+}
+
+// configFile is the layout of the gateway configuration file
+type configFile struct {
+	Providers      []CustomProvider      `json:"providers"`
+	Fallback       FallbackConfig        `json:"fallback"`
+	Router         RouterConfig          `json:"router"`
+	Retry          RetryConfig           `json:"retry"`
+	CircuitBreaker CircuitBreakerConfig  `json:"circuit_breaker"`
+	RateLimits     RateLimitConfig       `json:"rate_limits"`
+	RequestLog     RequestLogConfig      `json:"request_log"`
+	Pricing        map[string]ModelPrice `json:"pricing"` // "provider/model" -> price, overrides the model catalogs
+	Budgets        BudgetConfig          `json:"budgets"`
+	ResponseCache  ResponseCacheConfig   `json:"response_cache"`
+	SemanticCache  SemanticCacheConfig   `json:"semantic_cache"`
+}
 
 // LoadConfig creates a new configuration instance
-func LoadConfig() *Config {
-	return &Config{}
+// Custom providers and the fallback chain are read from the file named by GATEWAY_CONFIG_FILE, if set
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+
+	if secrets.CustomProviderKeys != "" {
+		if err := json.Unmarshal([]byte(secrets.CustomProviderKeys), &cfg.customKeys); err != nil {
+			return nil, fmt.Errorf("invalid CustomProviderKeys secret: %v", err)
+		}
+	}
+
+	path := os.Getenv(ConfigFileEnv)
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var file configFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range builtinProviders {
+		seen[p] = true
+	}
+	for _, p := range file.Providers {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("custom provider %s: name already in use", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	cfg.CustomProviders = file.Providers
+
+	for _, p := range file.Fallback.Providers {
+		if !seen[p] {
+			return nil, fmt.Errorf("fallback: unknown provider %s", p)
+		}
+	}
+	cfg.Fallback = file.Fallback
+
+	for alias, targets := range file.Router.Aliases {
+		if len(targets) == 0 {
+			return nil, fmt.Errorf("router: alias %s has no targets", alias)
+		}
+		for _, target := range targets {
+			if _, _, ok := cfg.SplitModel(target); !ok {
+				return nil, fmt.Errorf("router: alias %s: target %q must be \"provider/model\" with a known provider", alias, target)
+			}
+		}
+	}
+	cfg.Router = file.Router
+
+	for p := range file.Retry.Providers {
+		if !seen[p] {
+			return nil, fmt.Errorf("retry: unknown provider %s", p)
+		}
+	}
+	cfg.Retry = file.Retry
+	cfg.CircuitBreaker = file.CircuitBreaker
+
+	if err := file.RateLimits.Key.validate(); err != nil {
+		return nil, fmt.Errorf("rate_limits: key: %v", err)
+	}
+	for p, limit := range file.RateLimits.Providers {
+		if !seen[p] {
+			return nil, fmt.Errorf("rate_limits: unknown provider %s", p)
+		}
+		if err := limit.validate(); err != nil {
+			return nil, fmt.Errorf("rate_limits: provider %s: %v", p, err)
+		}
+	}
+	cfg.RateLimits = file.RateLimits
+	cfg.RequestLog = file.RequestLog
+
+	for model, price := range file.Pricing {
+		if _, _, ok := cfg.SplitModel(model); !ok {
+			return nil, fmt.Errorf("pricing: %q must be \"provider/model\" with a known provider", model)
+		}
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("pricing: %s: prices must not be negative", model)
+		}
+	}
+	cfg.Pricing = file.Pricing
+
+	if file.Budgets.WarnThreshold < 0 || file.Budgets.WarnThreshold > 1 {
+		return nil, fmt.Errorf("budgets: warn_threshold must be between 0 and 1")
+	}
+	cfg.Budgets = file.Budgets
+
+	if file.ResponseCache.TTLSeconds < 0 {
+		return nil, fmt.Errorf("response_cache: ttl_seconds must not be negative")
+	}
+	cfg.ResponseCache = file.ResponseCache
+
+	if file.SemanticCache.Threshold < 0 || file.SemanticCache.Threshold > 1 {
+		return nil, fmt.Errorf("semantic_cache: threshold must be between 0 and 1")
+	}
+	if file.SemanticCache.TTLSeconds < 0 || file.SemanticCache.MaxEntries < 0 {
+		return nil, fmt.Errorf("semantic_cache: ttl_seconds and max_entries must not be negative")
+	}
+	cfg.SemanticCache = file.SemanticCache
+
+	return cfg, nil
+}
+
+// validate checks that a rate limit is not negative
+func (l RateLimit) validate() error {
+	if l.RequestsPerMinute < 0 || l.TokensPerMinute < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// validate checks that a custom provider has the required fields
+func (p *CustomProvider) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("custom provider: name is required")
+	}
+	if p.BaseURL == "" {
+		return fmt.Errorf("custom provider %s: base_url is required", p.Name)
+	}
+	if p.DefaultModel == "" {
+		return fmt.Errorf("custom provider %s: default_model is required", p.Name)
+	}
+
+	switch p.AuthScheme {
+	case "", "bearer", AuthSchemeNone:
+	case "header":
+		if p.AuthHeader == "" {
+			return fmt.Errorf("custom provider %s: auth_header is required for the header auth scheme", p.Name)
+		}
+	default:
+		return fmt.Errorf("custom provider %s: unknown auth_scheme %q", p.Name, p.AuthScheme)
+	}
+
+	if p.AuthScheme != AuthSchemeNone && p.SecretName == "" {
+		return fmt.Errorf("custom provider %s: secret_name is required", p.Name)
+	}
+
+	for _, m := range p.Models {
+		if m.ID == "" {
+			return fmt.Errorf("custom provider %s: model id is required", p.Name)
+		}
+	}
+	return nil
 }
 
 // GetAPIKey returns the API key for the specified provider
@@ -32,9 +325,22 @@ func (c *Config) GetAPIKey(provider string) string {
 		return secrets.AtlasAPIKey
 	case "chutes":
 		return secrets.ChutesAPIKey
-	default:
-		return "" // Empty string for unknown providers
 	}
+
+	if custom := c.getCustomProvider(provider); custom != nil && custom.SecretName != "" {
+		// Custom provider keys come from the CustomProviderKeys secret, falling back to the environment
+		if key := c.customKeys[custom.SecretName]; key != "" {
+			return key
+		}
+		return os.Getenv(custom.SecretName)
+	}
+
+	return "" // Empty string for unknown providers
+}
+
+// GetGatewayAdminKey returns the bootstrap admin key of the gateway, empty if not set
+func (c *Config) GetGatewayAdminKey() string {
+	return secrets.GatewayAdminKey
 }
 
 // HasAPIKey checks if a provider has a non-empty API key configured
@@ -42,9 +348,27 @@ func (c *Config) HasAPIKey(provider string) bool {
 	return c.GetAPIKey(provider) != ""
 }
 
+// RequiresAPIKey reports whether calls to the provider need an API key
+func (c *Config) RequiresAPIKey(provider string) bool {
+	if custom := c.getCustomProvider(provider); custom != nil {
+		return custom.AuthScheme != AuthSchemeNone
+	}
+	return true
+}
+
+// IsConfigured checks if a provider can be called, i.e. it has an API key or needs none
+func (c *Config) IsConfigured(provider string) bool {
+	return !c.RequiresAPIKey(provider) || c.HasAPIKey(provider)
+}
+
 // GetSupportedProviders returns list of supported providers
 func (c *Config) GetSupportedProviders() []string {
-	return []string{"groq", "openrouter", "gemini", "atlas", "chutes"}
+	providers := make([]string, 0, len(builtinProviders)+len(c.CustomProviders))
+	providers = append(providers, builtinProviders...)
+	for _, p := range c.CustomProviders {
+		providers = append(providers, p.Name)
+	}
+	return providers
 }
 
 // IsValidProvider checks if a provider is supported
@@ -56,3 +380,57 @@ func (c *Config) IsValidProvider(provider string) bool {
 	}
 	return false
 }
+
+// MapModel returns the model to use on provider when falling back from a request for model
+func (c *Config) MapModel(model, provider string) (string, bool) {
+	mapped, ok := c.Fallback.ModelMap[model][provider]
+	return mapped, ok
+}
+
+// SplitModel splits a provider-prefixed model such as "groq/llama-3.3-70b-versatile"
+// into the provider and the upstream model. It reports false if the prefix is not a
+// known provider, e.g. for "meta-llama/llama-3.3-70b-instruct".
+func (c *Config) SplitModel(model string) (string, string, bool) {
+	provider, upstream, found := strings.Cut(model, "/")
+	if !found || upstream == "" || !c.IsValidProvider(provider) {
+		return "", "", false
+	}
+	return provider, upstream, true
+}
+
+// ResolveAlias returns the "provider/model" targets of a model alias
+func (c *Config) ResolveAlias(alias string) ([]string, bool) {
+	targets, ok := c.Router.Aliases[alias]
+	return targets, ok
+}
+
+// GetRetryConfig returns the retry configuration for a provider, with its overrides applied
+func (c *Config) GetRetryConfig(provider string) RetryConfig {
+	retry := RetryConfig{
+		MaxAttempts: c.Retry.MaxAttempts,
+		BaseDelayMs: c.Retry.BaseDelayMs,
+		MaxDelayMs:  c.Retry.MaxDelayMs,
+	}
+
+	override := c.Retry.Providers[provider]
+	if override.MaxAttempts > 0 {
+		retry.MaxAttempts = override.MaxAttempts
+	}
+	if override.BaseDelayMs > 0 {
+		retry.BaseDelayMs = override.BaseDelayMs
+	}
+	if override.MaxDelayMs > 0 {
+		retry.MaxDelayMs = override.MaxDelayMs
+	}
+	return retry
+}
+
+// getCustomProvider returns the custom provider with the given name, or nil
+func (c *Config) getCustomProvider(name string) *CustomProvider {
+	for i := range c.CustomProviders {
+		if c.CustomProviders[i].Name == name {
+			return &c.CustomProviders[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"encore.dev/storage/cache"
+
+	"encore.app/src/models"
+)
+
+// gatewayCache is the gateway's cache cluster (Redis)
+var gatewayCache = cache.NewCluster("gateway", cache.ClusterConfig{
+	EvictionPolicy: cache.AllKeysLRU,
+})
+
+// cachedResponses holds chat responses by request hash, see services.ResponseCache
+var cachedResponses = cache.NewStructKeyspace[string, models.ChatResponse](gatewayCache, cache.KeyspaceConfig{
+	KeyPattern: "responses/:key",
+})
@@ -2,7 +2,10 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"net/http"
+
+	"encore.dev/beta/errs"
 
 	"encore.app/src/config"
 	"encore.app/src/models"
@@ -14,23 +17,191 @@ import (
 //encore:service
 type Service struct {
 	chatService *services.ChatService
+	keys        *services.KeyService
+	budgets     *services.BudgetService
+	requestLog  *services.RequestLog
+	usage       *services.UsageLedger
 }
 
 // initService initializes the service with required dependencies
 func initService() (*Service, error) {
-	cfg := config.LoadConfig()
-	chatService := services.NewChatService(cfg)
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	budgets := services.NewBudgetService(gatewayDB, cfg, BudgetWarnings)
+	var responses services.ResponseStore = services.NewEncoreResponseStore(cachedResponses)
+	if cfg.ResponseCache.InMemory {
+		responses = services.NewMemoryResponseStore()
+	}
+	prices := services.NewModelPrices(cfg)
+	usage := services.NewUsageLedger(gatewayDB, prices.Price)
+	chatService := services.NewChatService(cfg, prices, budgets, services.NewResponseCache(cfg, responses), usage)
 
 	return &Service{
 		chatService: chatService,
+		keys:        services.NewKeyService(gatewayDB, cfg),
+		budgets:     budgets,
+		requestLog:  services.NewRequestLog(gatewayDB, cfg),
+		usage:       usage,
 	}, nil
 }
 
-// ChatCompletion handles chat completion requests
+// ChatCompletion handles chat completion requests.
+// It is a raw endpoint so that requests with "stream": true can be answered
+// with server-sent events instead of a single JSON response.
 //
-//encore:api public method=POST path=/chat/completions
-func (s *Service) ChatCompletion(ctx context.Context, req *models.ChatRequest) (*models.ChatResponse, error) {
-	return s.chatService.ProcessChatCompletion(req)
+//encore:api auth raw method=POST path=/chat/completions
+func (s *Service) ChatCompletion(w http.ResponseWriter, r *http.Request) {
+	ctx, err := authorize(r.Context(), models.ScopeChat)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req models.ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, invalidBody(err))
+		return
+	}
+
+	s.serveChatCompletion(ctx, w, r.URL.Path, &req, (*sseWriter).WriteChunk, func(response *models.ChatResponse) {
+		writeJSON(w, http.StatusOK, response)
+	})
+}
+
+// Completion handles legacy text completion requests by running the prompt
+// as a single user message through the chat completion service.
+//
+//encore:api auth raw method=POST path=/v1/completions
+func (s *Service) Completion(w http.ResponseWriter, r *http.Request) {
+	ctx, err := authorize(r.Context(), models.ScopeChat)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req models.CompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, invalidBody(err))
+		return
+	}
+	if req.Prompt == "" {
+		writeError(w, &errs.Error{Code: errs.InvalidArgument, Message: "prompt cannot be empty"})
+		return
+	}
+
+	s.serveChatCompletion(ctx, w, r.URL.Path, req.ChatRequest(), (*sseWriter).WriteCompletionChunk, func(response *models.ChatResponse) {
+		writeJSON(w, http.StatusOK, models.NewCompletionResponse(response))
+	})
+}
+
+// Embeddings handles embeddings requests. It is a raw endpoint so that input
+// can be given as a single string or an array of strings, as in the OpenAI API.
+//
+//encore:api auth raw method=POST path=/v1/embeddings
+func (s *Service) Embeddings(w http.ResponseWriter, r *http.Request) {
+	ctx, err := authorize(r.Context(), models.ScopeEmbeddings)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req models.EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, invalidBody(err))
+		return
+	}
+
+	record := s.requestLog.BeginEmbeddings(ctx, r.URL.Path, &req)
+	w.Header().Set("X-Request-ID", record.ID())
+
+	ctx, status, err := s.chatService.CheckEmbeddingsRateLimit(ctx, &req)
+	writeRateLimitHeaders(w, status)
+	if err != nil {
+		writeError(w, err)
+		s.usage.Record(ctx, record.FinishEmbeddings(ctx, nil, err))
+		return
+	}
+
+	// Hold the admitted budget until the usage is in the ledger
+	ctx = s.budgets.Reserve(ctx)
+	defer s.budgets.Release(ctx)
+
+	response, err := s.chatService.ProcessEmbeddings(ctx, &req)
+	s.usage.Record(ctx, record.FinishEmbeddings(ctx, response, err))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// serveChatCompletion rate limits, runs, logs and meters a chat request. A streamed request
+// is answered with server-sent events written by writeChunk, any other with respond.
+func (s *Service) serveChatCompletion(ctx context.Context, w http.ResponseWriter, endpoint string, req *models.ChatRequest, writeChunk func(sse *sseWriter, chunk *models.ChatCompletionChunk) error, respond func(response *models.ChatResponse)) {
+	record := s.requestLog.Begin(ctx, endpoint, req)
+	w.Header().Set("X-Request-ID", record.ID())
+	ctx = services.WithRequestID(ctx, record.ID())
+	finish := func(response *models.ChatResponse, err error) {
+		entry := record.Finish(ctx, response, err)
+		if entry.Cache != models.CacheHit {
+			s.usage.Record(ctx, entry)
+		}
+	}
+
+	ctx, status, err := s.chatService.CheckRateLimit(ctx, req)
+	writeRateLimitHeaders(w, status)
+	if err != nil {
+		writeError(w, err)
+		finish(nil, err)
+		return
+	}
+
+	// Hold the admitted budget until finish has metered the usage
+	ctx = s.budgets.Reserve(ctx)
+	defer s.budgets.Release(ctx)
+
+	if req.Stream != nil && *req.Stream {
+		sse := newSSEWriter(w)
+		err := s.streamChatCompletion(ctx, w, req, sse, func(chunk *models.ChatCompletionChunk) error {
+			record.Observe(chunk)
+			return writeChunk(sse, chunk)
+		})
+		finish(nil, err)
+		return
+	}
+
+	response, err := s.chatService.ProcessChatCompletion(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		finish(nil, err)
+		return
+	}
+
+	if response.CacheStatus != "" {
+		w.Header().Set("x-cache", response.CacheStatus)
+	}
+	respond(response)
+	finish(response, nil)
+}
+
+// streamChatCompletion streams the completion as server-sent events, writing every chunk with onChunk
+func (s *Service) streamChatCompletion(ctx context.Context, w http.ResponseWriter, req *models.ChatRequest, sse *sseWriter, onChunk func(chunk *models.ChatCompletionChunk) error) error {
+	err := s.chatService.ProcessChatCompletionStream(ctx, req, onChunk)
+	if err != nil {
+		// Nothing has been sent yet, so a regular error response is still possible
+		if !sse.Started() {
+			writeError(w, err)
+			return err
+		}
+		sse.WriteError(err)
+		return err
+	}
+
+	sse.Done()
+	return nil
 }
 
 // HealthCheck returns the health status of the service
@@ -43,20 +214,38 @@ func (s *Service) HealthCheck(ctx context.Context) (*models.HealthResponse, erro
 
 // GetProviders returns the list of supported AI providers
 //
-//encore:api public method=GET path=/providers
+//encore:api auth method=GET path=/providers
 func (s *Service) GetProviders(ctx context.Context) (*models.ProvidersResponse, error) {
 	response := s.chatService.GetSupportedProviders()
 	return response, nil
 }
 
-// TestProvider tests if a specific provider is working
+// ListModels returns the models of every configured provider that the caller's key may use
+//
+//encore:api auth method=GET path=/v1/models
+func (s *Service) ListModels(ctx context.Context) (*models.ModelsResponse, error) {
+	ctx, err := authorize(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	response := s.chatService.ListModels(ctx)
+	return response, nil
+}
+
+// TestProvider probes a provider with a tiny completion and reports latency,
+// the model used, the upstream status and a classified failure reason
 //
-//encore:api public method=POST path=/providers/test
+//encore:api auth method=POST path=/providers/test
 func (s *Service) TestProvider(ctx context.Context, req *models.TestProviderRequest) (*models.TestProviderResponse, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
 	if req.Provider == "" {
-		return nil, fmt.Errorf("provider is required")
+		return nil, &errs.Error{Code: errs.InvalidArgument, Message: "provider is required"}
 	}
 
-	response := s.chatService.TestProvider(req)
+	response := s.chatService.TestProvider(ctx, req)
 	return response, nil
 }
@@ -0,0 +1,8 @@
+package controllers
+
+import "encore.dev/storage/sqldb"
+
+// gatewayDB is the gateway database, its schema lives in ./migrations
+var gatewayDB = sqldb.NewDatabase("gateway", sqldb.DatabaseConfig{
+	Migrations: "./migrations",
+})
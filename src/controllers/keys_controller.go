@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+
+	"encore.app/src/models"
+	"encore.app/src/services"
+)
+
+// AuthHandler authenticates requests carrying a gateway API key as "Authorization: Bearer <key>"
+//
+//encore:authhandler
+func (s *Service) AuthHandler(ctx context.Context, token string) (auth.UID, *models.APIKey, error) {
+	key, err := s.keys.Authenticate(ctx, token)
+	if err != nil {
+		return "", nil, err
+	}
+	return auth.UID(strconv.FormatInt(key.ID, 10)), key, nil
+}
+
+// authorize checks that the gateway key of the request grants scope, if one is
+// given, and returns ctx limited to the providers and models the key allows
+func authorize(ctx context.Context, scope string) (context.Context, error) {
+	key, _ := auth.Data().(*models.APIKey)
+	if key == nil {
+		return ctx, &errs.Error{Code: errs.Unauthenticated, Message: "missing API key"}
+	}
+	if scope != "" && !key.HasScope(scope) {
+		return ctx, &errs.Error{Code: errs.PermissionDenied, Message: fmt.Sprintf("API key %q lacks the %s scope", key.Name, scope)}
+	}
+	return services.WithAPIKey(ctx, key), nil
+}
+
+// CreateAPIKey issues a gateway API key. The key is only returned in this response.
+//
+//encore:api auth method=POST path=/admin/keys
+func (s *Service) CreateAPIKey(ctx context.Context, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return s.keys.CreateKey(ctx, req)
+}
+
+// ListAPIKeys returns every gateway API key, including revoked ones
+//
+//encore:api auth method=GET path=/admin/keys
+func (s *Service) ListAPIKeys(ctx context.Context) (*models.ListAPIKeysResponse, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return s.keys.ListKeys(ctx)
+}
+
+// RevokeAPIKey revokes a gateway API key
+//
+//encore:api auth method=DELETE path=/admin/keys/:id
+func (s *Service) RevokeAPIKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return s.keys.RevokeKey(ctx, id)
+}
+
+// SetAPIKeyBudget replaces the daily or monthly token and cost budget of a gateway API key.
+// A budget without tokens and cost_usd removes it.
+//
+//encore:api auth method=PUT path=/admin/keys/:id/budget
+func (s *Service) SetAPIKeyBudget(ctx context.Context, id int64, req *models.Budget) (*models.APIKey, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return s.budgets.SetBudget(ctx, id, req)
+}
+
+// GetAPIKeyBudget reports the budget of a gateway API key and its spend in the current period
+//
+//encore:api auth method=GET path=/admin/keys/:id/budget
+func (s *Service) GetAPIKeyBudget(ctx context.Context, id int64) (*models.BudgetStatus, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return s.budgets.Status(ctx, id)
+}
@@ -0,0 +1,12 @@
+CREATE TABLE api_keys (
+    id                BIGSERIAL PRIMARY KEY,
+    name              TEXT NOT NULL,
+    key_hash          TEXT NOT NULL UNIQUE, -- SHA-256 of the key, the key itself is never stored
+    key_prefix        TEXT NOT NULL,
+    scopes            TEXT[] NOT NULL,
+    allowed_providers TEXT[] NOT NULL DEFAULT '{}',
+    allowed_models    TEXT[] NOT NULL DEFAULT '{}',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at      TIMESTAMPTZ,
+    revoked_at        TIMESTAMPTZ
+);
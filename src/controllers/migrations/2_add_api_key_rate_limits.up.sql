@@ -0,0 +1,4 @@
+-- Per-key overrides of the configured gateway key rate limit, NULL uses the default
+ALTER TABLE api_keys
+    ADD COLUMN requests_per_minute INTEGER,
+    ADD COLUMN tokens_per_minute   INTEGER;
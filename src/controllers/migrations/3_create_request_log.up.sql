@@ -0,0 +1,26 @@
+CREATE TABLE request_log (
+    id                BIGSERIAL PRIMARY KEY,
+    request_id        TEXT NOT NULL UNIQUE,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    endpoint          TEXT NOT NULL,
+    api_key_id        BIGINT, -- NULL for the bootstrap admin key
+    api_key_name      TEXT NOT NULL DEFAULT '',
+    provider          TEXT NOT NULL DEFAULT '',
+    model             TEXT NOT NULL DEFAULT '',
+    requested_model   TEXT NOT NULL DEFAULT '',
+    stream            BOOLEAN NOT NULL DEFAULT FALSE,
+    parameters        JSONB NOT NULL DEFAULT '{}',
+    status            INTEGER NOT NULL,
+    error             TEXT NOT NULL DEFAULT '',
+    finish_reason     TEXT NOT NULL DEFAULT '',
+    latency_ms        BIGINT NOT NULL,
+    prompt_tokens     INTEGER,
+    completion_tokens INTEGER,
+    total_tokens      INTEGER,
+    request_body      JSONB, -- Only stored when request_log.store_bodies is enabled
+    response_body     JSONB
+);
+
+CREATE INDEX request_log_api_key_id_idx ON request_log (api_key_id, id);
+CREATE INDEX request_log_provider_idx ON request_log (provider, id);
+CREATE INDEX request_log_created_at_idx ON request_log (created_at);
@@ -0,0 +1,17 @@
+CREATE TABLE usage_ledger (
+    id                BIGSERIAL PRIMARY KEY,
+    request_id        TEXT NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    api_key_id        BIGINT, -- NULL for the bootstrap admin key
+    api_key_name      TEXT NOT NULL DEFAULT '',
+    provider          TEXT NOT NULL,
+    model             TEXT NOT NULL,
+    prompt_tokens     INTEGER NOT NULL,
+    completion_tokens INTEGER NOT NULL,
+    input_price       NUMERIC(12, 6), -- USD per million tokens at the time of the request, NULL if unknown
+    output_price      NUMERIC(12, 6),
+    cost_usd          NUMERIC(18, 8)  -- NULL if the model has no known price
+);
+
+CREATE INDEX usage_ledger_created_at_idx ON usage_ledger (created_at);
+CREATE INDEX usage_ledger_api_key_id_idx ON usage_ledger (api_key_id, created_at);
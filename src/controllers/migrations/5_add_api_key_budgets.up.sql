@@ -0,0 +1,13 @@
+-- Per-key spend budgets per calendar period (UTC), NULL for no budget
+ALTER TABLE api_keys
+    ADD COLUMN budget_period   TEXT,
+    ADD COLUMN token_budget    BIGINT,
+    ADD COLUMN cost_budget_usd NUMERIC(18, 8);
+
+-- Budget warnings already published, at most one per key and period
+CREATE TABLE budget_warnings (
+    api_key_id   BIGINT NOT NULL REFERENCES api_keys (id),
+    period_start TIMESTAMPTZ NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (api_key_id, period_start)
+);
@@ -0,0 +1,2 @@
+-- Response cache status of a request: hit, miss, or empty if the cache was not consulted
+ALTER TABLE request_log ADD COLUMN cache TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,19 @@
+package controllers
+
+import (
+	"context"
+
+	"encore.app/src/models"
+)
+
+// ListRequests returns a page of the request log, newest first, filtered by key,
+// provider, model, status and time range
+//
+//encore:api auth method=GET path=/admin/requests
+func (s *Service) ListRequests(ctx context.Context, req *models.ListRequestsRequest) (*models.ListRequestsResponse, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return s.requestLog.List(ctx, req)
+}
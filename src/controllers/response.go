@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/src/models"
+	"encore.app/src/services"
+)
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[CONTROLLER] Failed to write response: %v", err)
+	}
+}
+
+// writeError writes err as an OpenAI-style error response, with the HTTP status of its error code
+func writeError(w http.ResponseWriter, err error) {
+	var limitErr *services.RateLimitError
+	if errors.As(err, &limitErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+	}
+
+	apiErr := services.ToAPIError(err)
+	writeJSON(w, apiErr.Code.HTTPStatus(), models.NewErrorResponse(apiErr))
+}
+
+// writeRateLimitHeaders sets the OpenAI-style x-ratelimit-* headers for the limits of the caller's key
+func writeRateLimitHeaders(w http.ResponseWriter, status *services.RateLimitStatus) {
+	if status == nil {
+		return
+	}
+
+	header := w.Header()
+	if status.LimitRequests > 0 {
+		header.Set("x-ratelimit-limit-requests", strconv.Itoa(status.LimitRequests))
+		header.Set("x-ratelimit-remaining-requests", strconv.Itoa(status.RemainingRequests))
+		header.Set("x-ratelimit-reset-requests", status.ResetRequests.Round(time.Millisecond).String())
+	}
+	if status.LimitTokens > 0 {
+		header.Set("x-ratelimit-limit-tokens", strconv.Itoa(status.LimitTokens))
+		header.Set("x-ratelimit-remaining-tokens", strconv.Itoa(status.RemainingTokens))
+		header.Set("x-ratelimit-reset-tokens", status.ResetTokens.Round(time.Millisecond).String())
+	}
+}
+
+// invalidBody returns the error for a request body that could not be decoded
+func invalidBody(err error) error {
+	return &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("invalid request body: %v", err)}
+}
+
+// invalidQuery returns the error for a query parameter that could not be parsed
+func invalidQuery(name string, err error) error {
+	return &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf("invalid query parameter %s: %v", name, err)}
+}
+
+// sseWriter writes server-sent events, sending the stream headers lazily on the first event
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+// newSSEWriter creates a new server-sent events writer
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	flusher, _ := w.(http.Flusher)
+	return &sseWriter{w: w, flusher: flusher}
+}
+
+// Started reports whether any event has been written
+func (s *sseWriter) Started() bool {
+	return s.started
+}
+
+// WriteChunk writes a completion chunk as an OpenAI-style chat.completion.chunk data event
+func (s *sseWriter) WriteChunk(chunk *models.ChatCompletionChunk) error {
+	return s.writeJSON(chunk)
+}
+
+// WriteCompletionChunk writes a completion chunk as a text_completion data event
+func (s *sseWriter) WriteCompletionChunk(chunk *models.ChatCompletionChunk) error {
+	return s.writeJSON(models.NewCompletionChunk(chunk))
+}
+
+// writeJSON writes v as a data event
+func (s *sseWriter) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chunk: %v", err)
+	}
+	return s.writeEvent(data)
+}
+
+// WriteError writes an error event, used when a stream fails after it has started
+func (s *sseWriter) WriteError(err error) {
+	data, _ := json.Marshal(models.NewErrorResponse(services.ToAPIError(err)))
+	if writeErr := s.writeEvent(data); writeErr != nil {
+		log.Printf("[CONTROLLER] Failed to write stream error: %v", writeErr)
+	}
+}
+
+// Done writes the terminating [DONE] event
+func (s *sseWriter) Done() {
+	if err := s.writeEvent([]byte("[DONE]")); err != nil {
+		log.Printf("[CONTROLLER] Failed to finish stream: %v", err)
+	}
+}
+
+// writeEvent writes a single data event and flushes it to the client
+func (s *sseWriter) writeEvent(data []byte) error {
+	if !s.started {
+		header := s.w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		s.w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
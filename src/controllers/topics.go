@@ -0,0 +1,13 @@
+package controllers
+
+import (
+	"encore.dev/pubsub"
+
+	"encore.app/src/models"
+)
+
+// BudgetWarnings receives a BudgetWarning when a gateway key reaches the warning
+// threshold of its budget, once per key and budget period
+var BudgetWarnings = pubsub.NewTopic[*models.BudgetWarning]("budget-warnings", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
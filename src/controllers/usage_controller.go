@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"encore.app/src/models"
+)
+
+// usageCSVHeader are the columns of the usage CSV export
+var usageCSVHeader = []string{
+	"day", "api_key_id", "api_key_name", "provider", "model", "requests",
+	"prompt_tokens", "completion_tokens", "total_tokens", "cost_usd", "unpriced_requests",
+}
+
+// GetUsage returns token usage and cost aggregated by day, key, provider and model,
+// filtered by key, provider, model and time range
+//
+//encore:api auth method=GET path=/admin/usage
+func (s *Service) GetUsage(ctx context.Context, req *models.UsageRequest) (*models.UsageReport, error) {
+	ctx, err := authorize(ctx, models.ScopeAdmin)
+	if err != nil {
+		return nil, err
+	}
+	return s.usage.Report(ctx, req)
+}
+
+// ExportUsage returns the same report as GetUsage as a CSV file, one row per group.
+// It is a raw endpoint so that the response is not JSON.
+//
+//encore:api auth raw method=GET path=/admin/usage/export
+func (s *Service) ExportUsage(w http.ResponseWriter, r *http.Request) {
+	ctx, err := authorize(r.Context(), models.ScopeAdmin)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	req, err := parseUsageRequest(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	report, err := s.usage.Report(ctx, req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	out := csv.NewWriter(w)
+	out.Write(usageCSVHeader)
+	for _, row := range report.Rows {
+		keyID := ""
+		if row.APIKeyID != nil {
+			keyID = strconv.FormatInt(*row.APIKeyID, 10)
+		}
+		out.Write([]string{
+			row.Day,
+			keyID,
+			row.APIKeyName,
+			row.Provider,
+			row.Model,
+			strconv.FormatInt(row.Requests, 10),
+			strconv.FormatInt(row.PromptTokens, 10),
+			strconv.FormatInt(row.CompletionTokens, 10),
+			strconv.FormatInt(row.TotalTokens, 10),
+			strconv.FormatFloat(row.CostUSD, 'f', -1, 64),
+			strconv.FormatInt(row.UnpricedRequests, 10),
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Printf("[CONTROLLER] Failed to write usage export: %v", err)
+	}
+}
+
+// parseUsageRequest parses the query parameters of GetUsage
+func parseUsageRequest(query url.Values) (*models.UsageRequest, error) {
+	req := &models.UsageRequest{
+		GroupBy:  query.Get("group_by"),
+		Provider: query.Get("provider"),
+		Model:    query.Get("model"),
+	}
+
+	if value := query.Get("key_id"); value != "" {
+		keyID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, invalidQuery("key_id", err)
+		}
+		req.KeyID = keyID
+	}
+	for name, dest := range map[string]*time.Time{"since": &req.Since, "until": &req.Until} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, invalidQuery(name, err)
+			}
+			*dest = t
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Budget periods, calendar days and months in UTC
+const (
+	BudgetPeriodDay   = "day"
+	BudgetPeriodMonth = "month"
+)
+
+// Budget caps the usage of a gateway key in each period. Requests that would
+// exceed either cap are rejected. A budget without tokens and cost_usd is no budget.
+type Budget struct {
+	Period  string   `json:"period"`             // day or month
+	Tokens  *int64   `json:"tokens,omitempty"`   // Prompt plus completion tokens, absent for no token cap
+	CostUSD *float64 `json:"cost_usd,omitempty"` // Absent for no cost cap
+}
+
+// BudgetStatus describes the spend of a gateway key in its current budget period
+type BudgetStatus struct {
+	APIKeyID    int64     `json:"api_key_id"`
+	Budget      *Budget   `json:"budget,omitempty"` // Absent if the key has no budget
+	PeriodStart time.Time `json:"period_start,omitempty"`
+	ResetsAt    time.Time `json:"resets_at,omitempty"`
+	SpentTokens int64     `json:"spent_tokens"`
+	SpentUSD    float64   `json:"spent_usd"`
+}
+
+// BudgetWarning is published once per period when a gateway key has used the
+// warning threshold of its budget
+type BudgetWarning struct {
+	APIKeyID    int64     `json:"api_key_id"`
+	APIKeyName  string    `json:"api_key_name"`
+	Budget      Budget    `json:"budget"`
+	PeriodStart time.Time `json:"period_start"`
+	SpentTokens int64     `json:"spent_tokens"`
+	SpentUSD    float64   `json:"spent_usd"`
+	Threshold   float64   `json:"threshold"` // Share of the budget that triggered the warning, e.g. 0.8
+}
@@ -1,26 +1,244 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // ChatRequest represents a chat completion request
 type ChatRequest struct {
-	Messages    []ChatMessage `json:"messages"` // Added to support multi-modal
-	Prompt      string        `json:"prompt"`
-	Model       string        `json:"model,omitempty"`
-	Temperature *float64      `json:"temperature,omitempty" default:"0.5"`
-	MaxTokens   *int          `json:"max_tokens,omitempty" default:"1000"`
-	Stream      *bool         `json:"stream,omitempty"`
-	Provider    string        `json:"provider,omitempty"`
-	WithImage   bool          `json:"withImage,omitempty"`
-	Tools       []Tool        `json:"tools,omitempty"`
-}
-
-// Tool represents a tool that can be used by the model
+	Messages         []ChatMessage      `json:"messages"` // Added to support multi-modal
+	Prompt           string             `json:"prompt"`
+	Model            string             `json:"model,omitempty"`
+	Temperature      *float64           `json:"temperature,omitempty" default:"0.5"`
+	MaxTokens        *int               `json:"max_tokens,omitempty" default:"1000"`
+	TopP             *float64           `json:"top_p,omitempty"`
+	TopK             *int               `json:"top_k,omitempty"`
+	Stop             StopList           `json:"stop,omitempty"`
+	Seed             *int               `json:"seed,omitempty"`
+	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64           `json:"frequency_penalty,omitempty"`
+	N                *int               `json:"n,omitempty"` // Number of choices to generate
+	LogitBias        map[string]float64 `json:"logit_bias,omitempty"`
+	User             string             `json:"user,omitempty"` // End-user identifier passed to the provider
+	Stream           *bool              `json:"stream,omitempty"`
+	Provider         ProviderList       `json:"provider,omitempty"`
+	WithImage        bool               `json:"withImage,omitempty"`
+	Tools            []Tool             `json:"tools,omitempty"`
+	ToolChoice       *ToolChoice        `json:"tool_choice,omitempty"`
+	ResponseFormat   *ResponseFormat    `json:"response_format,omitempty"`
+	Timeout          *int               `json:"timeout,omitempty"`        // Upstream timeout in seconds, overrides the provider default
+	ContentFormat    string             `json:"content_format,omitempty"` // "string" (OpenAI) or "parts", see WantsStringContent
+	Cache            string             `json:"cache,omitempty"`          // "no-store" bypasses the response cache, "semantic" also uses the semantic cache
+}
+
+// Response cache request modes and statuses
+const (
+	CacheNoStore  = "no-store"
+	CacheSemantic = "semantic"
+	CacheHit      = "hit"
+	CacheMiss     = "miss"
+)
+
+// Response cache types
+const (
+	CacheTypeExact    = "exact"
+	CacheTypeSemantic = "semantic"
+)
+
+// CacheInfo describes the cache entry a response was served from
+type CacheInfo struct {
+	Type       string   `json:"type"`                 // exact or semantic
+	Similarity *float64 `json:"similarity,omitempty"` // Cosine similarity to the cached question, for semantic hits
+}
+
+// Response formats
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat requests structured output: {"type": "json_object"} for any
+// JSON object or {"type": "json_schema", "json_schema": {...}} for a schema
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat describes the JSON schema the response must conform to
+type JSONSchemaFormat struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// StopList is a stop sequence or a list of stop sequences.
+// In JSON it accepts both "END" and ["END", "STOP"].
+type StopList []string
+
+// UnmarshalJSON decodes a single stop sequence or a list of sequences
+func (s *StopList) UnmarshalJSON(data []byte) error {
+	var sequence string
+	if err := json.Unmarshal(data, &sequence); err == nil {
+		if sequence == "" {
+			*s = nil
+		} else {
+			*s = StopList{sequence}
+		}
+		return nil
+	}
+
+	var sequences []string
+	if err := json.Unmarshal(data, &sequences); err != nil {
+		return fmt.Errorf("stop must be a string or an array of strings")
+	}
+	*s = sequences
+	return nil
+}
+
+// Content formats of response messages
+const (
+	ContentFormatString = "string"
+	ContentFormatParts  = "parts"
+)
+
+// WantsStringContent reports whether response messages should carry plain string content.
+// Without a content_format it is true when every request message sent string content.
+func (r *ChatRequest) WantsStringContent() bool {
+	if r.ContentFormat != "" {
+		return r.ContentFormat == ContentFormatString
+	}
+	for _, msg := range r.Messages {
+		if msg.partsContent {
+			return false
+		}
+	}
+	return true
+}
+
+// ProviderList is a provider name or an ordered list of providers to fall back through.
+// In JSON it accepts both "groq" and ["groq", "openrouter"].
+type ProviderList []string
+
+// UnmarshalJSON decodes a single provider name or a list of names
+func (p *ProviderList) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		if name == "" {
+			*p = nil
+		} else {
+			*p = ProviderList{name}
+		}
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("provider must be a string or an array of strings")
+	}
+	*p = names
+	return nil
+}
+
+// MarshalJSON encodes a single provider as a plain string
+func (p ProviderList) MarshalJSON() ([]byte, error) {
+	if len(p) == 1 {
+		return json.Marshal(p[0])
+	}
+	return json.Marshal([]string(p))
+}
+
+// Tool represents a tool that can be used by the model: an OpenAI-style
+// function ({"type": "function", "function": {...}}) or Gemini's Google Search
 type Tool struct {
-	GoogleSearch GoogleSearch `json:"google_search,omitempty"`
+	Type         string              `json:"type,omitempty"`
+	Function     *FunctionDefinition `json:"function,omitempty"`
+	GoogleSearch *GoogleSearch       `json:"google_search,omitempty"`
+}
+
+// IsFunction reports whether the tool is a function the model can call
+func (t *Tool) IsFunction() bool {
+	return t.Function != nil
+}
+
+// FunctionDefinition describes a function the model can call
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"` // JSON schema of the arguments
 }
 
 // GoogleSearch represents the Google Search tool
 type GoogleSearch struct{}
 
+// Tool choice modes
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// ToolChoice controls which tool the model calls. In JSON it is either a mode
+// ("auto", "none", "required") or {"type": "function", "function": {"name": "..."}}.
+type ToolChoice struct {
+	Mode     string // auto, none or required; empty when Function is set
+	Function string // Name of the function the model must call
+}
+
+// UnmarshalJSON decodes a tool choice mode or a named function
+func (c *ToolChoice) UnmarshalJSON(data []byte) error {
+	var mode string
+	if err := json.Unmarshal(data, &mode); err == nil {
+		switch mode {
+		case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+			*c = ToolChoice{Mode: mode}
+			return nil
+		}
+		return fmt.Errorf("unknown tool_choice %q", mode)
+	}
+
+	var named struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(data, &named); err != nil || named.Function.Name == "" {
+		return fmt.Errorf("tool_choice must be a mode or a function")
+	}
+	*c = ToolChoice{Function: named.Function.Name}
+	return nil
+}
+
+// MarshalJSON encodes the tool choice in the OpenAI format
+func (c ToolChoice) MarshalJSON() ([]byte, error) {
+	if c.Function == "" {
+		return json.Marshal(c.Mode)
+	}
+	return json.Marshal(map[string]interface{}{
+		"type": "function",
+		"function": map[string]string{
+			"name": c.Function,
+		},
+	})
+}
+
+// ToolCall represents a function call requested by the model
+type ToolCall struct {
+	Index    *int         `json:"index,omitempty"` // Position of the call, only set in streamed deltas
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall holds the name and JSON-encoded arguments of a function call
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
 // ContentPart represents a part of the content (text or image)
 type ContentPart struct {
 	Type     string    `json:"type"`
@@ -33,10 +251,81 @@ type ImageURL struct {
 	URL string `json:"url"`
 }
 
-// ChatMessage represents a single message in a chat conversation
+// ChatMessage represents a single message in a chat conversation.
+// In JSON its content is either an OpenAI string or an array of content parts.
 type ChatMessage struct {
-	Role    string        `json:"role"`
-	Content []ContentPart `json:"content"`
+	Role       string        `json:"role"`
+	Content    []ContentPart `json:"content"`
+	Name       string        `json:"name,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`   // Function calls made by an assistant message
+	ToolCallID string        `json:"tool_call_id,omitempty"` // Call answered by a "tool" message
+
+	partsContent  bool // Content was decoded from an array of parts
+	stringContent bool // Content is encoded as a plain string
+}
+
+// UnmarshalJSON decodes a message whose content is a string, an array of parts or null
+func (m *ChatMessage) UnmarshalJSON(data []byte) error {
+	type plainMessage ChatMessage
+	var raw struct {
+		plainMessage
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = ChatMessage(raw.plainMessage)
+
+	if len(raw.Content) == 0 || string(raw.Content) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw.Content, &text); err == nil {
+		m.Content = []ContentPart{{Type: "text", Text: text}}
+		return nil
+	}
+
+	if err := json.Unmarshal(raw.Content, &m.Content); err != nil {
+		return fmt.Errorf("message content must be a string or an array of content parts")
+	}
+	m.partsContent = true
+	return nil
+}
+
+// MarshalJSON encodes the message, with plain string content if SetStringContent was called
+func (m ChatMessage) MarshalJSON() ([]byte, error) {
+	type plainMessage ChatMessage
+	msg := struct {
+		plainMessage
+		Content interface{} `json:"content"`
+	}{plainMessage: plainMessage(m), Content: m.Content}
+
+	if m.stringContent {
+		// OpenAI sends null content alongside tool calls when there is no text
+		if text := m.Text(); text != "" || len(m.ToolCalls) == 0 {
+			msg.Content = text
+		} else {
+			msg.Content = nil
+		}
+	}
+	return json.Marshal(msg)
+}
+
+// SetStringContent makes the message encode its content as a plain string
+func (m *ChatMessage) SetStringContent(enabled bool) {
+	m.stringContent = enabled
+}
+
+// Text returns the concatenated text parts of the message
+func (m *ChatMessage) Text() string {
+	text := ""
+	for _, part := range m.Content {
+		if part.Type == "text" {
+			text += part.Text
+		}
+	}
+	return text
 }
 
 // Choice represents a choice in the completion response
@@ -48,12 +337,28 @@ type Choice struct {
 
 // ChatResponse represents a chat completion response (OpenAI compatible)
 type ChatResponse struct {
-	ID      string   `json:"id"`
-	Object  string   `json:"object"`
-	Created int64    `json:"created"`
-	Model   string   `json:"model"`
-	Choices []Choice `json:"choices"`
-	Usage   Usage    `json:"usage"`
+	ID       string     `json:"id"`
+	Object   string     `json:"object"`
+	Created  int64      `json:"created"`
+	Model    string     `json:"model"`
+	Choices  []Choice   `json:"choices"`
+	Usage    Usage      `json:"usage"`
+	Provider string     `json:"provider,omitempty"` // Provider that served the request
+	Cache    *CacheInfo `json:"cache,omitempty"`    // Set when the response was served from the cache
+
+	// CacheStatus is CacheHit or CacheMiss when the response cache was consulted,
+	// reported in the x-cache header
+	CacheStatus string `json:"-"`
+	// PricedModel is the model requested from the provider, which prices the
+	// request; the provider may report a more specific Model
+	PricedModel string `json:"-"`
+}
+
+// SetStringContent makes every choice encode its message content as a plain string
+func (r *ChatResponse) SetStringContent(enabled bool) {
+	for i := range r.Choices {
+		r.Choices[i].Message.SetStringContent(enabled)
+	}
 }
 
 // Usage represents token usage information
@@ -65,9 +370,18 @@ type Usage struct {
 
 // HealthResponse represents health check response
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Timestamp string            `json:"timestamp"`
-	Services  map[string]string `json:"services"`
+	Status    string                    `json:"status"`
+	Timestamp string                    `json:"timestamp"`
+	Services  map[string]string         `json:"services"`
+	Providers map[string]ProviderHealth `json:"providers,omitempty"`
+}
+
+// ProviderHealth represents the circuit breaker state of a provider
+type ProviderHealth struct {
+	State        string `json:"state"` // closed, open or half_open
+	FailureCount int    `json:"failure_count"`
+	LastFailure  string `json:"last_failure,omitempty"` // e.g. rate_limited, network or upstream_error
+	LastErrorAt  string `json:"last_error_at,omitempty"`
 }
 
 // ProvidersResponse represents supported providers response
@@ -75,13 +389,71 @@ type ProvidersResponse struct {
 	Providers []string `json:"providers"`
 }
 
+// ModelsResponse represents the model list response (OpenAI compatible)
+type ModelsResponse struct {
+	Object string       `json:"object"`
+	Data   []ModelEntry `json:"data"`
+}
+
+// ModelEntry represents a model in the model list
+type ModelEntry struct {
+	ID             string        `json:"id"`
+	Object         string        `json:"object"`
+	Created        int64         `json:"created"`
+	OwnedBy        string        `json:"owned_by"`
+	Provider       string        `json:"provider"`
+	ContextWindow  int           `json:"context_window,omitempty"`
+	SupportsVision bool          `json:"supports_vision"`
+	SupportsTools  bool          `json:"supports_tools"`
+	Pricing        *ModelPricing `json:"pricing,omitempty"`
+}
+
+// ModelPricing represents the price of a model in USD per million tokens
+type ModelPricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
 // TestProviderRequest represents a provider test request
 type TestProviderRequest struct {
 	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"` // Model to probe, defaults to the provider's default model
 }
 
 // TestProviderResponse represents a provider test response
 type TestProviderResponse struct {
-	Provider string `json:"provider"`
-	Status   string `json:"status"`
+	Provider   string `json:"provider"`
+	Status     string `json:"status"`
+	Model      string `json:"model,omitempty"`       // Model the probe was sent to
+	LatencyMs  int64  `json:"latency_ms,omitempty"`  // Round trip time of the probe
+	HTTPStatus int    `json:"http_status,omitempty"` // Upstream HTTP status, absent if no response was received
+	Reason     string `json:"reason,omitempty"`      // Classified failure: invalid_key, quota_exhausted, rate_limited, model_not_found, network, timeout, ...
+	Error      string `json:"error,omitempty"`
+}
+
+// ChatCompletionChunk represents a streamed chat completion chunk (OpenAI compatible)
+type ChatCompletionChunk struct {
+	ID       string        `json:"id"`
+	Object   string        `json:"object"`
+	Created  int64         `json:"created"`
+	Model    string        `json:"model"`
+	Choices  []ChunkChoice `json:"choices"`
+	Usage    *Usage        `json:"usage,omitempty"`
+	Provider string        `json:"provider,omitempty"` // Provider that served the request
+
+	PricedModel string `json:"-"` // Model requested from the provider, see ChatResponse.PricedModel
+}
+
+// ChunkChoice represents a choice in a streamed completion chunk
+type ChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+// ChunkDelta represents the incremental message content of a streamed choice
+type ChunkDelta struct {
+	Role      string     `json:"role,omitempty"`
+	Content   string     `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// assertJSON fails unless got and want encode the same JSON value
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid JSON %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestResponseFormatJSON(t *testing.T) {
+	strict := true
+
+	tests := []struct {
+		name    string
+		input   string // response_format of a chat request
+		want    *ResponseFormat
+		wantErr bool
+	}{
+		{"absent", `{}`, nil, false},
+		{"text", `{"response_format": {"type": "text"}}`, &ResponseFormat{Type: ResponseFormatText}, false},
+		{"json object", `{"response_format": {"type": "json_object"}}`, &ResponseFormat{Type: ResponseFormatJSONObject}, false},
+		{"json schema", `{"response_format": {"type": "json_schema", "json_schema": {"name": "answer", "description": "An answer", "schema": {"type":"object"}, "strict": true}}}`,
+			&ResponseFormat{Type: ResponseFormatJSONSchema, JSONSchema: &JSONSchemaFormat{Name: "answer", Description: "An answer", Schema: json.RawMessage(`{"type":"object"}`), Strict: &strict}}, false},
+		{"json schema without schema", `{"response_format": {"type": "json_schema", "json_schema": {"name": "answer"}}}`,
+			&ResponseFormat{Type: ResponseFormatJSONSchema, JSONSchema: &JSONSchemaFormat{Name: "answer"}}, false},
+		{"not an object", `{"response_format": "json_object"}`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatRequest
+			err := json.Unmarshal([]byte(tt.input), &req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decoded %s, want an error", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(req.ResponseFormat, tt.want) {
+				t.Fatalf("got %+v, want %+v", req.ResponseFormat, tt.want)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			// The schema is passed to providers as given
+			data, err := json.Marshal(req.ResponseFormat)
+			if err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			var again ResponseFormat
+			if err := json.Unmarshal(data, &again); err != nil || !reflect.DeepEqual(&again, tt.want) {
+				t.Fatalf("encoded as %s, which decodes to %+v (%v)", data, again, err)
+			}
+		})
+	}
+}
+
+func TestProviderListJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ProviderList
+		encoded string // ProviderList encoded again
+		wantErr bool
+	}{
+		{`"groq"`, ProviderList{"groq"}, `"groq"`, false},
+		{`["groq","openrouter"]`, ProviderList{"groq", "openrouter"}, `["groq","openrouter"]`, false},
+		{`["groq"]`, ProviderList{"groq"}, `"groq"`, false},
+		{`""`, nil, `null`, false},
+		{`{"name":"groq"}`, nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got ProviderList
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decoded %s, want an error", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			assertJSON(t, data, tt.encoded)
+		})
+	}
+}
+
+func TestToolChoiceJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ToolChoice
+		wantErr bool
+	}{
+		{`"auto"`, ToolChoice{Mode: ToolChoiceAuto}, false},
+		{`"none"`, ToolChoice{Mode: ToolChoiceNone}, false},
+		{`"required"`, ToolChoice{Mode: ToolChoiceRequired}, false},
+		{`{"type":"function","function":{"name":"get_weather"}}`, ToolChoice{Function: "get_weather"}, false},
+		{`"sometimes"`, ToolChoice{}, true},
+		{`{"type":"function","function":{}}`, ToolChoice{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got ToolChoice
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decoded %s as %+v, want an error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			assertJSON(t, data, tt.input)
+		})
+	}
+}
+
+func TestChatMessageJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantParts bool   // Decoded as content parts
+		want      string // Encoded again, with string content unless wantParts
+		wantErr   bool
+	}{
+		{"string content", `{"role":"user","content":"hi"}`, false, `{"role":"user","content":"hi"}`, false},
+		{"content parts", `{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`,
+			true, `{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`, false},
+		{"null content with tool calls", `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]}`,
+			false, `{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]}`, false},
+		{"tool result", `{"role":"tool","content":"42","tool_call_id":"call_1"}`, false, `{"role":"tool","content":"42","tool_call_id":"call_1"}`, false},
+		{"missing content", `{"role":"user"}`, false, `{"role":"user","content":""}`, false},
+		{"invalid content", `{"role":"user","content":42}`, false, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg ChatMessage
+			err := json.Unmarshal([]byte(tt.input), &msg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decoded %s, want an error", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if msg.partsContent != tt.wantParts {
+				t.Fatalf("decoded as parts %v, want %v", msg.partsContent, tt.wantParts)
+			}
+
+			msg.SetStringContent(!tt.wantParts)
+			data, err := json.Marshal(msg)
+			if err != nil {
+				t.Fatalf("encoding failed: %v", err)
+			}
+			assertJSON(t, data, tt.want)
+		})
+	}
+}
+
+func TestStopListJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    StopList
+		wantErr bool
+	}{
+		{`"END"`, StopList{"END"}, false},
+		{`["END","STOP"]`, StopList{"END", "STOP"}, false},
+		{`""`, nil, false},
+		{`[]`, StopList{}, false},
+		{`3`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got StopList
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
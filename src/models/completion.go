@@ -0,0 +1,103 @@
+package models
+
+// CompletionRequest represents a legacy text completion request (OpenAI compatible)
+type CompletionRequest struct {
+	Prompt           string             `json:"prompt"`
+	Model            string             `json:"model,omitempty"`
+	Temperature      *float64           `json:"temperature,omitempty"`
+	MaxTokens        *int               `json:"max_tokens,omitempty"`
+	TopP             *float64           `json:"top_p,omitempty"`
+	Stop             StopList           `json:"stop,omitempty"`
+	Seed             *int               `json:"seed,omitempty"`
+	PresencePenalty  *float64           `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64           `json:"frequency_penalty,omitempty"`
+	N                *int               `json:"n,omitempty"`
+	LogitBias        map[string]float64 `json:"logit_bias,omitempty"`
+	User             string             `json:"user,omitempty"`
+	Stream           *bool              `json:"stream,omitempty"`
+	Provider         ProviderList       `json:"provider,omitempty"`
+	Timeout          *int               `json:"timeout,omitempty"` // Upstream timeout in seconds, overrides the provider default
+}
+
+// ChatRequest converts the completion request into a chat request with the prompt as its only message
+func (r *CompletionRequest) ChatRequest() *ChatRequest {
+	return &ChatRequest{
+		Prompt:           r.Prompt,
+		Model:            r.Model,
+		Temperature:      r.Temperature,
+		MaxTokens:        r.MaxTokens,
+		TopP:             r.TopP,
+		Stop:             r.Stop,
+		Seed:             r.Seed,
+		PresencePenalty:  r.PresencePenalty,
+		FrequencyPenalty: r.FrequencyPenalty,
+		N:                r.N,
+		LogitBias:        r.LogitBias,
+		User:             r.User,
+		Stream:           r.Stream,
+		Provider:         r.Provider,
+		Timeout:          r.Timeout,
+	}
+}
+
+// CompletionChoice represents a choice in a text completion response
+type CompletionChoice struct {
+	Text         string      `json:"text"`
+	Index        int         `json:"index"`
+	Logprobs     interface{} `json:"logprobs"` // Always null, log probabilities are not supported
+	FinishReason *string     `json:"finish_reason"`
+}
+
+// CompletionResponse represents a text completion response or streamed chunk (OpenAI compatible)
+type CompletionResponse struct {
+	ID       string             `json:"id"`
+	Object   string             `json:"object"`
+	Created  int64              `json:"created"`
+	Model    string             `json:"model"`
+	Choices  []CompletionChoice `json:"choices"`
+	Usage    *Usage             `json:"usage,omitempty"`
+	Provider string             `json:"provider,omitempty"` // Provider that served the request
+}
+
+// NewCompletionResponse converts a chat completion into a text completion
+func NewCompletionResponse(chat *ChatResponse) *CompletionResponse {
+	response := &CompletionResponse{
+		ID:       chat.ID,
+		Object:   "text_completion",
+		Created:  chat.Created,
+		Model:    chat.Model,
+		Choices:  make([]CompletionChoice, len(chat.Choices)),
+		Usage:    &chat.Usage,
+		Provider: chat.Provider,
+	}
+	for i, choice := range chat.Choices {
+		finishReason := choice.FinishReason
+		response.Choices[i] = CompletionChoice{
+			Text:         choice.Message.Text(),
+			Index:        choice.Index,
+			FinishReason: &finishReason,
+		}
+	}
+	return response
+}
+
+// NewCompletionChunk converts a streamed chat completion chunk into a text completion chunk
+func NewCompletionChunk(chunk *ChatCompletionChunk) *CompletionResponse {
+	response := &CompletionResponse{
+		ID:       chunk.ID,
+		Object:   "text_completion",
+		Created:  chunk.Created,
+		Model:    chunk.Model,
+		Choices:  make([]CompletionChoice, len(chunk.Choices)),
+		Usage:    chunk.Usage,
+		Provider: chunk.Provider,
+	}
+	for i, choice := range chunk.Choices {
+		response.Choices[i] = CompletionChoice{
+			Text:         choice.Delta.Content,
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+		}
+	}
+	return response
+}
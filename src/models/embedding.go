@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Embedding encoding formats
+const (
+	EncodingFormatFloat  = "float"
+	EncodingFormatBase64 = "base64"
+)
+
+// EmbeddingRequest represents an embeddings request (OpenAI compatible)
+type EmbeddingRequest struct {
+	Input          EmbeddingInput `json:"input"`
+	Model          string         `json:"model,omitempty"`
+	Provider       ProviderList   `json:"provider,omitempty"`
+	EncodingFormat string         `json:"encoding_format,omitempty"` // float (default) or base64
+	Dimensions     *int           `json:"dimensions,omitempty"`      // Size of the returned vectors, if the model supports it
+	User           string         `json:"user,omitempty"`
+}
+
+// EmbeddingInput is a text or a list of texts to embed.
+// In JSON it accepts both "text" and ["text", "other text"].
+type EmbeddingInput []string
+
+// UnmarshalJSON decodes a single text or a list of texts
+func (e *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*e = EmbeddingInput{text}
+		return nil
+	}
+
+	var texts []string
+	if err := json.Unmarshal(data, &texts); err != nil {
+		return fmt.Errorf("input must be a string or an array of strings")
+	}
+	*e = texts
+	return nil
+}
+
+// EmbeddingResponse represents an embeddings response (OpenAI compatible)
+type EmbeddingResponse struct {
+	Object   string          `json:"object"`
+	Data     []EmbeddingData `json:"data"`
+	Model    string          `json:"model"`
+	Usage    EmbeddingUsage  `json:"usage"`
+	Provider string          `json:"provider,omitempty"` // Provider that served the request
+
+	PricedModel string `json:"-"` // Model requested from the provider, see ChatResponse.PricedModel
+}
+
+// EmbeddingData represents the embedding of one input
+type EmbeddingData struct {
+	Object    string      `json:"object"`
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"` // []float64, or a base64 string of little-endian float32s
+}
+
+// EmbeddingUsage represents token usage of an embeddings request
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import "encore.dev/beta/errs"
+
+// OpenAI error types
+const (
+	ErrorTypeInvalidRequest = "invalid_request_error"
+	ErrorTypeAuthentication = "authentication_error"
+	ErrorTypeNotFound       = "not_found_error"
+	ErrorTypeRateLimit      = "rate_limit_error"
+	ErrorTypeTimeout        = "timeout_error"
+	ErrorTypeAPI            = "api_error"
+)
+
+// ProviderErrorDetails describes the upstream failure behind an error
+type ProviderErrorDetails struct {
+	Provider       string `json:"provider,omitempty"`
+	UpstreamStatus int    `json:"upstream_status,omitempty"` // HTTP status returned by the provider, 0 if it was not reached
+	Retryable      bool   `json:"retryable"`
+}
+
+// ErrDetails marks ProviderErrorDetails as Encore error details
+func (ProviderErrorDetails) ErrDetails() {}
+
+// ErrorResponse represents an error response (OpenAI compatible)
+type ErrorResponse struct {
+	Error ErrorObject `json:"error"`
+}
+
+// ErrorObject represents the error of an ErrorResponse
+type ErrorObject struct {
+	Message        string  `json:"message"`
+	Type           string  `json:"type"`
+	Param          *string `json:"param"`
+	Code           string  `json:"code"` // Encore error code, e.g. invalid_argument
+	Provider       string  `json:"provider,omitempty"`
+	UpstreamStatus int     `json:"upstream_status,omitempty"`
+	Retryable      *bool   `json:"retryable,omitempty"`
+}
+
+// NewErrorResponse converts an Encore error into the OpenAI error format
+func NewErrorResponse(err *errs.Error) *ErrorResponse {
+	object := ErrorObject{
+		Message: err.Message,
+		Type:    errorType(err.Code),
+		Code:    err.Code.String(),
+	}
+	if details, ok := err.Details.(ProviderErrorDetails); ok {
+		object.Provider = details.Provider
+		object.UpstreamStatus = details.UpstreamStatus
+		object.Retryable = &details.Retryable
+	}
+	return &ErrorResponse{Error: object}
+}
+
+// errorType maps an Encore error code to the closest OpenAI error type
+func errorType(code errs.ErrCode) string {
+	switch code {
+	case errs.InvalidArgument, errs.FailedPrecondition, errs.OutOfRange:
+		return ErrorTypeInvalidRequest
+	case errs.Unauthenticated, errs.PermissionDenied:
+		return ErrorTypeAuthentication
+	case errs.NotFound:
+		return ErrorTypeNotFound
+	case errs.ResourceExhausted:
+		return ErrorTypeRateLimit
+	case errs.DeadlineExceeded:
+		return ErrorTypeTimeout
+	default:
+		return ErrorTypeAPI
+	}
+}
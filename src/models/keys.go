@@ -0,0 +1,75 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Gateway API key scopes
+const (
+	ScopeChat       = "chat"       // Chat and text completions
+	ScopeEmbeddings = "embeddings" // Embeddings
+	ScopeAdmin      = "admin"      // Key management and provider tests, implies every other scope
+)
+
+// APIKey describes a gateway-issued API key. The secret itself is only returned when the key is created.
+type APIKey struct {
+	ID                int64      `json:"id"`
+	Name              string     `json:"name"`
+	Prefix            string     `json:"prefix"` // First characters of the key, to tell keys apart
+	Scopes            []string   `json:"scopes"`
+	AllowedProviders  []string   `json:"allowed_providers"`             // Empty means every provider
+	AllowedModels     []string   `json:"allowed_models"`                // "provider/model", bare model or alias names; empty means every model
+	RequestsPerMinute *int       `json:"requests_per_minute,omitempty"` // Overrides the configured key rate limit, 0 means unlimited
+	TokensPerMinute   *int       `json:"tokens_per_minute,omitempty"`
+	Budget            *Budget    `json:"budget,omitempty"` // Absent if the key has no budget
+	CreatedAt         time.Time  `json:"created_at"`
+	LastUsedAt        *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key grants scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+// AllowsProvider reports whether the key may use provider
+func (k *APIKey) AllowsProvider(provider string) bool {
+	return len(k.AllowedProviders) == 0 || slices.Contains(k.AllowedProviders, provider)
+}
+
+// AllowsModel reports whether the key may use model on provider. Any of the
+// names given matches an entry, so that an alias can be allowed as a whole.
+func (k *APIKey) AllowsModel(provider, model string, names ...string) bool {
+	if len(k.AllowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range k.AllowedModels {
+		if allowed == provider+"/"+model || allowed == model || slices.Contains(names, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKeyRequest represents a request to issue a gateway API key
+type CreateAPIKeyRequest struct {
+	Name              string   `json:"name"`
+	Scopes            []string `json:"scopes"`
+	AllowedProviders  []string `json:"allowed_providers,omitempty"`
+	AllowedModels     []string `json:"allowed_models,omitempty"`
+	RequestsPerMinute *int     `json:"requests_per_minute,omitempty"` // Defaults to the configured key rate limit
+	TokensPerMinute   *int     `json:"tokens_per_minute,omitempty"`
+	Budget            *Budget  `json:"budget,omitempty"`
+}
+
+// CreateAPIKeyResponse represents a newly issued gateway API key
+type CreateAPIKeyResponse struct {
+	Key    string  `json:"key"` // The secret, shown only once
+	APIKey *APIKey `json:"api_key"`
+}
+
+// ListAPIKeysResponse represents the list of gateway API keys
+type ListAPIKeysResponse struct {
+	Keys []*APIKey `json:"keys"`
+}
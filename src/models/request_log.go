@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Request log status filters
+const (
+	RequestStatusSuccess = "success"
+	RequestStatusError   = "error"
+)
+
+// RequestLogEntry represents a logged chat or text completion request
+type RequestLogEntry struct {
+	ID             int64           `json:"id"`
+	RequestID      string          `json:"request_id"` // Also returned to the caller in the X-Request-ID header
+	CreatedAt      time.Time       `json:"created_at"`
+	Endpoint       string          `json:"endpoint"`
+	APIKeyID       *int64          `json:"api_key_id,omitempty"` // Absent for the bootstrap admin key
+	APIKeyName     string          `json:"api_key_name,omitempty"`
+	Provider       string          `json:"provider,omitempty"` // Provider that served or last failed the request
+	Model          string          `json:"model,omitempty"`    // Model reported by the provider
+	RequestedModel string          `json:"requested_model,omitempty"`
+	Stream         bool            `json:"stream"`
+	Parameters     json.RawMessage `json:"parameters"` // Request without messages and prompt
+	Status         int             `json:"status"`     // HTTP status returned to the caller
+	Error          string          `json:"error,omitempty"`
+	FinishReason   string          `json:"finish_reason,omitempty"`
+	LatencyMs      int64           `json:"latency_ms"`
+	Usage          *Usage          `json:"usage,omitempty"`
+	UsageEstimate  *Usage          `json:"-"`                       // Estimated usage of a served request whose provider reported none, for metering
+	PricedModel    string          `json:"-"`                       // Model requested from the provider, which prices the request
+	Cache          string          `json:"cache,omitempty"`         // Response cache status, hit or miss
+	RequestBody    json.RawMessage `json:"request_body,omitempty"`  // Only stored when request_log.store_bodies is enabled
+	ResponseBody   json.RawMessage `json:"response_body,omitempty"` // Chat completion response, text only for streams
+}
+
+// ListRequestsRequest represents a query of the request log, newest first
+type ListRequestsRequest struct {
+	Limit    int       `query:"limit"`  // Page size, defaults to 50
+	Before   int64     `query:"before"` // Cursor: only entries with a smaller id, see ListRequestsResponse.NextCursor
+	KeyID    int64     `query:"key_id"`
+	Provider string    `query:"provider"`
+	Model    string    `query:"model"`  // Matches the requested or the served model
+	Status   string    `query:"status"` // success or error
+	Since    time.Time `query:"since"`
+	Until    time.Time `query:"until"`
+}
+
+// ListRequestsResponse represents a page of the request log
+type ListRequestsResponse struct {
+	Requests   []*RequestLogEntry `json:"requests"`
+	NextCursor *int64             `json:"next_cursor,omitempty"` // Pass as before to get the next page, absent on the last page
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Usage report dimensions
+const (
+	UsageByDay      = "day"
+	UsageByKey      = "key"
+	UsageByProvider = "provider"
+	UsageByModel    = "model"
+)
+
+// UsageRequest represents a query of the usage ledger
+type UsageRequest struct {
+	GroupBy  string    `query:"group_by"` // Comma-separated dimensions: day, key, provider, model; defaults to all of them
+	KeyID    int64     `query:"key_id"`
+	Provider string    `query:"provider"`
+	Model    string    `query:"model"`
+	Since    time.Time `query:"since"`
+	Until    time.Time `query:"until"`
+}
+
+// UsageRow represents the usage of one group of a usage report. Dimensions the
+// report is not grouped by are empty.
+type UsageRow struct {
+	Day              string  `json:"day,omitempty"` // UTC date, YYYY-MM-DD
+	APIKeyID         *int64  `json:"api_key_id,omitempty"`
+	APIKeyName       string  `json:"api_key_name,omitempty"`
+	Provider         string  `json:"provider,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	UnpricedRequests int64   `json:"unpriced_requests"` // Requests to models without a known price, not included in cost_usd
+}
+
+// UsageReport represents aggregated usage and cost
+type UsageReport struct {
+	Rows  []UsageRow `json:"rows"`
+	Total UsageRow   `json:"total"`
+}
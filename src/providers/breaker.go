@@ -0,0 +1,260 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+// BreakerState is the state of a provider's circuit breaker
+type BreakerState string
+
+const (
+	// BreakerClosed lets all calls through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects all calls until the cool-down has passed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single trial call through to probe the provider
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// Default circuit breaker settings
+const (
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerCooldown         = 30 * time.Second
+)
+
+// CircuitOpenError is returned when a call is rejected because the provider's breaker is open
+type CircuitOpenError struct {
+	Provider string
+	RetryIn  time.Duration
+}
+
+// Error implements the error interface
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("provider %s is unavailable (circuit open, retry in %v)", e.Provider, e.RetryIn.Round(time.Second))
+}
+
+// BreakerStatus is a snapshot of a circuit breaker
+type BreakerStatus struct {
+	State        BreakerState
+	FailureCount int
+	LastFailure  string // Classified reason of the last failure, one of the Failure* reasons
+	LastErrorAt  time.Time
+}
+
+// CircuitBreaker tracks consecutive upstream failures of a provider. It opens after
+// FailureThreshold failures, rejects calls during the cool-down and then half-opens
+// to let one trial call decide whether to close again.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	cooldown         time.Duration
+
+	mu          sync.Mutex
+	state       BreakerState
+	failures    int
+	lastFailure string
+	lastErrorAt time.Time
+	openedAt    time.Time
+	probing     bool
+}
+
+// NewCircuitBreaker creates a new closed circuit breaker
+func NewCircuitBreaker(name string, failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	if failureThreshold <= 0 {
+		failureThreshold = DefaultBreakerFailureThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		state:            BreakerClosed,
+	}
+}
+
+// Allow returns nil if a call may go through, or a CircuitOpenError if not
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if wait := b.cooldown - time.Since(b.openedAt); wait > 0 {
+			return &CircuitOpenError{Provider: b.name, RetryIn: wait}
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		log.Printf("[BREAKER] %s half-open, probing provider", b.name)
+		return nil
+	case BreakerHalfOpen:
+		// Only one trial call at a time while half-open
+		if b.probing {
+			return &CircuitOpenError{Provider: b.name}
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record records the outcome of a call that was allowed through
+func (b *CircuitBreaker) Record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	// A caller that went away says nothing about the provider
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	// A request rejected before it went upstream, e.g. for unsupported parameters,
+	// says nothing about the provider either
+	if err != nil && !IsRetryable(err) && !respondedUpstream(err) {
+		return
+	}
+
+	// Only transient upstream failures count, a rejected request means the provider is up
+	if err == nil || !IsRetryable(err) {
+		if b.state != BreakerClosed {
+			log.Printf("[BREAKER] %s closed", b.name)
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	// Only the reason is kept, error text may quote upstream responses
+	b.lastFailure = ClassifyFailure(ctx, err)
+	b.lastErrorAt = time.Now()
+
+	if b.state == BreakerHalfOpen || b.failures >= b.failureThreshold {
+		if b.state != BreakerOpen {
+			log.Printf("[BREAKER] %s open after %d failures: %v", b.name, b.failures, err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// respondedUpstream reports whether err carries a response from the provider
+func respondedUpstream(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr)
+}
+
+// Status returns a snapshot of the breaker
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state
+	if state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		// The next call will be let through as a trial
+		state = BreakerHalfOpen
+	}
+
+	return BreakerStatus{
+		State:        state,
+		FailureCount: b.failures,
+		LastFailure:  b.lastFailure,
+		LastErrorAt:  b.lastErrorAt,
+	}
+}
+
+// guardedProvider wraps a provider with its circuit breaker
+type guardedProvider struct {
+	Provider
+	breaker *CircuitBreaker
+}
+
+// unwrapProvider returns the provider behind its circuit breaker
+func unwrapProvider(provider Provider) Provider {
+	if guarded, ok := provider.(*guardedProvider); ok {
+		return guarded.Provider
+	}
+	return provider
+}
+
+// ChatCompletion calls the wrapped provider unless its breaker is open
+func (g *guardedProvider) ChatCompletion(ctx context.Context, req *models.ChatRequest, apiKey string) (*models.ChatResponse, error) {
+	if err := g.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	response, err := g.Provider.ChatCompletion(ctx, req, apiKey)
+	g.breaker.Record(ctx, err)
+	return response, err
+}
+
+// ChatCompletionStream streams from the wrapped provider unless its breaker is open
+func (g *guardedProvider) ChatCompletionStream(ctx context.Context, req *models.ChatRequest, apiKey string, onChunk ChunkHandler) error {
+	streamer, ok := g.Provider.(StreamingProvider)
+	if !ok {
+		return fmt.Errorf("provider %s does not support streaming", g.GetName())
+	}
+
+	if err := g.breaker.Allow(); err != nil {
+		return err
+	}
+
+	err := streamer.ChatCompletionStream(ctx, req, apiKey, onChunk)
+	g.breaker.Record(ctx, err)
+	return err
+}
+
+// Embeddings embeds with the wrapped provider unless its breaker is open
+func (g *guardedProvider) Embeddings(ctx context.Context, req *models.EmbeddingRequest, apiKey string) (*EmbeddingResult, error) {
+	embedder, ok := g.Provider.(EmbeddingProvider)
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not support embeddings", g.GetName())
+	}
+
+	if err := g.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	result, err := embedder.Embeddings(ctx, req, apiKey)
+	g.breaker.Record(ctx, err)
+	return result, err
+}
+
+// EmbeddingModel returns the wrapped provider's default embedding model, empty if it cannot embed
+func (g *guardedProvider) EmbeddingModel() string {
+	if embedder, ok := g.Provider.(EmbeddingProvider); ok {
+		return embedder.EmbeddingModel()
+	}
+	return ""
+}
+
+// breakerSettings holds the circuit breaker settings applied to newly registered providers
+var breakerSettings = struct {
+	failureThreshold int
+	cooldown         time.Duration
+}{DefaultBreakerFailureThreshold, DefaultBreakerCooldown}
+
+// configureBreakers applies the circuit breaker configuration to providers registered afterwards
+func configureBreakers(cfg *config.Config) {
+	breakerSettings.failureThreshold = cfg.CircuitBreaker.FailureThreshold
+	breakerSettings.cooldown = time.Duration(cfg.CircuitBreaker.CooldownMs) * time.Millisecond
+}
+
+// IsCircuitOpen reports whether err was caused by an open circuit breaker
+func IsCircuitOpen(err error) bool {
+	var openErr *CircuitOpenError
+	return errors.As(err, &openErr)
+}
@@ -0,0 +1,116 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	transient := &APIError{Provider: "test", StatusCode: http.StatusServiceUnavailable, Retryable: true}
+	rejected := &APIError{Provider: "test", StatusCode: http.StatusBadRequest}
+	unsent := &UnsupportedParamsError{Provider: "test", Params: []string{ParamTopK}}
+
+	tests := []struct {
+		name      string
+		outcomes  []error
+		cooldown  time.Duration
+		wantState BreakerState
+		wantCount int
+		wantAllow bool
+	}{
+		{"closed after success", []error{nil}, time.Hour, BreakerClosed, 0, true},
+		{"closed below threshold", []error{transient, transient}, time.Hour, BreakerClosed, 2, true},
+		{"opens at threshold", []error{transient, transient, transient}, time.Hour, BreakerOpen, 3, false},
+		{"success resets count", []error{transient, transient, nil, transient}, time.Hour, BreakerClosed, 1, true},
+		{"rejected request is not a failure", []error{transient, transient, rejected}, time.Hour, BreakerClosed, 0, true},
+		{"half-opens after cool-down", []error{transient, transient, transient}, 0, BreakerHalfOpen, 3, true},
+		{"request never sent does not close", []error{transient, transient, transient, unsent}, time.Hour, BreakerOpen, 3, false},
+		{"request never sent does not reset count", []error{transient, transient, unsent}, time.Hour, BreakerClosed, 2, true},
+		{"upstream rejection of the content closes", []error{transient, transient, transient, &InvalidRequestError{Provider: "test", Err: rejected}}, time.Hour, BreakerClosed, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test", 3, time.Hour)
+			for _, err := range tt.outcomes {
+				b.Record(context.Background(), err)
+			}
+			b.cooldown = tt.cooldown
+
+			status := b.Status()
+			if status.State != tt.wantState || status.FailureCount != tt.wantCount {
+				t.Fatalf("got state %s with %d failures, want %s with %d", status.State, status.FailureCount, tt.wantState, tt.wantCount)
+			}
+			if err := b.Allow(); (err == nil) != tt.wantAllow {
+				t.Fatalf("Allow() = %v, want allowed %v", err, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	transient := &RequestError{Provider: "test", Err: errors.New("connection refused")}
+
+	b := NewCircuitBreaker("test", 1, time.Nanosecond)
+	b.Record(context.Background(), transient)
+	time.Sleep(time.Millisecond)
+
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	if err := b.Allow(); !IsCircuitOpen(err) {
+		t.Fatalf("second call during the trial got %v, want CircuitOpenError", err)
+	}
+
+	// A failed trial re-opens the breaker, a successful one closes it
+	b.cooldown = time.Hour
+	b.Record(context.Background(), transient)
+	if state := b.Status().State; state != BreakerOpen {
+		t.Fatalf("state after failed trial = %s, want open", state)
+	}
+	b.cooldown = 0
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	b.Record(context.Background(), nil)
+	if state := b.Status().State; state != BreakerClosed {
+		t.Fatalf("state after successful trial = %s, want closed", state)
+	}
+}
+
+func TestCircuitBreakerTrialNeverSent(t *testing.T) {
+	b := NewCircuitBreaker("test", 1, time.Hour)
+	b.cooldown = 0
+	b.Record(context.Background(), &APIError{Provider: "test", StatusCode: http.StatusBadGateway, Retryable: true})
+
+	// A trial rejected before it reached the provider leaves the breaker half-open for the next one
+	if err := b.Allow(); err != nil {
+		t.Fatalf("trial call rejected: %v", err)
+	}
+	b.Record(context.Background(), invalidRequest("test", "empty image URL provided"))
+	if state := b.Status().State; state != BreakerHalfOpen {
+		t.Fatalf("state after a trial that was never sent = %s, want half-open", state)
+	}
+	if err := b.Allow(); err != nil {
+		t.Fatalf("next trial call rejected: %v", err)
+	}
+}
+
+func TestCircuitBreakerReportsReasonOnly(t *testing.T) {
+	secret := "https://generativelanguage.googleapis.com/v1beta/models/m:generateContent?key=secret"
+	err := newRequestError("gemini", &url.Error{Op: "Post", URL: secret, Err: errors.New("connection reset")})
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("request error leaks the URL: %v", err)
+	}
+
+	b := NewCircuitBreaker("gemini", 5, time.Hour)
+	b.Record(context.Background(), err)
+	if got := b.Status().LastFailure; got != FailureNetwork {
+		t.Fatalf("LastFailure = %q, want %q", got, FailureNetwork)
+	}
+}
@@ -0,0 +1,60 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pricing is the price of a model in USD per million tokens
+type Pricing struct {
+	Input  float64 // Per million prompt tokens
+	Output float64 // Per million completion tokens
+}
+
+// ModelInfo describes a model offered by a provider
+type ModelInfo struct {
+	ID            string
+	ContextWindow int      // Maximum number of tokens, 0 if unknown
+	Vision        bool     // Accepts image inputs
+	Tools         bool     // Supports function calling
+	Pricing       *Pricing // nil if unknown
+}
+
+// ModelCatalog is implemented by providers that know which models they offer
+type ModelCatalog interface {
+	// Catalog returns the static model catalog
+	Catalog() []ModelInfo
+	// ListModels asks the provider which models it currently serves
+	ListModels(ctx context.Context, apiKey string) ([]ModelInfo, error)
+}
+
+// GetCatalog returns the static model catalog of a registered provider
+func GetCatalog(name string) ([]ModelInfo, error) {
+	catalog, err := getModelCatalog(name)
+	if err != nil {
+		return nil, err
+	}
+	return catalog.Catalog(), nil
+}
+
+// ListModels returns the models a registered provider currently serves
+func ListModels(ctx context.Context, name, apiKey string) ([]ModelInfo, error) {
+	catalog, err := getModelCatalog(name)
+	if err != nil {
+		return nil, err
+	}
+	return catalog.ListModels(ctx, apiKey)
+}
+
+// getModelCatalog returns the registered provider as a ModelCatalog
+func getModelCatalog(name string) (ModelCatalog, error) {
+	provider, err := GetProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	catalog, ok := unwrapProvider(provider).(ModelCatalog)
+	if !ok {
+		return nil, fmt.Errorf("provider %s has no model catalog", name)
+	}
+	return catalog, nil
+}
@@ -0,0 +1,48 @@
+package providers
+
+import (
+	"encore.app/src/config"
+)
+
+// NewCustomProvider creates a provider for an OpenAI-compatible endpoint declared in configuration
+func NewCustomProvider(cfg *config.Config, custom config.CustomProvider) *OpenAICompatibleProvider {
+	return NewOpenAICompatibleProvider(OpenAICompatibleConfig{
+		Name:               custom.Name,
+		BaseURL:            custom.BaseURL,
+		DefaultModel:       custom.DefaultModel,
+		DefaultVisionModel: custom.DefaultVisionModel,
+		Headers:            custom.Headers,
+		AuthScheme:         AuthScheme(custom.AuthScheme),
+		AuthHeader:         custom.AuthHeader,
+		Retry:              newRetryPolicy(cfg, custom.Name),
+		Models:             customModels(custom.Models),
+		UnsupportedParams:  custom.UnsupportedParams,
+
+		DefaultEmbeddingModel: custom.DefaultEmbeddingModel,
+		EmbeddingBatchSize:    custom.EmbeddingBatchSize,
+	})
+}
+
+// customModels converts the model catalog of a custom provider
+func customModels(specs []config.ModelSpec) []ModelInfo {
+	modelList := make([]ModelInfo, 0, len(specs))
+	for _, spec := range specs {
+		info := ModelInfo{
+			ID:            spec.ID,
+			ContextWindow: spec.ContextWindow,
+			Vision:        spec.Vision,
+			Tools:         spec.Tools,
+		}
+		if spec.InputPrice != nil || spec.OutputPrice != nil {
+			info.Pricing = &Pricing{}
+			if spec.InputPrice != nil {
+				info.Pricing.Input = *spec.InputPrice
+			}
+			if spec.OutputPrice != nil {
+				info.Pricing.Output = *spec.OutputPrice
+			}
+		}
+		modelList = append(modelList, info)
+	}
+	return modelList
+}
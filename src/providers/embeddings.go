@@ -0,0 +1,151 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"unicode/utf8"
+
+	"encore.app/src/models"
+)
+
+// DefaultEmbeddingBatchSize is the number of inputs sent per upstream embeddings call when none is configured
+const DefaultEmbeddingBatchSize = 256
+
+// EmbeddingResult holds the vectors of an embeddings call, in input order
+type EmbeddingResult struct {
+	Model   string
+	Vectors [][]float64
+	Usage   models.EmbeddingUsage
+}
+
+// EmbeddingProvider is implemented by providers that can embed text.
+type EmbeddingProvider interface {
+	Provider
+	// EmbeddingModel returns the model used when the request does not specify one, empty if the provider cannot embed
+	EmbeddingModel() string
+	Embeddings(ctx context.Context, req *models.EmbeddingRequest, apiKey string) (*EmbeddingResult, error)
+}
+
+// SupportsEmbeddings reports whether a registered provider can embed text
+func SupportsEmbeddings(name string) bool {
+	provider, err := GetProvider(name)
+	if err != nil {
+		return false
+	}
+	embedder, ok := unwrapProvider(provider).(EmbeddingProvider)
+	return ok && embedder.EmbeddingModel() != ""
+}
+
+// embedInBatches splits inputs into batches of at most size and concatenates the results of embedBatch
+func embedInBatches(inputs []string, size int, embedBatch func(batch []string) (*EmbeddingResult, error)) (*EmbeddingResult, error) {
+	result := &EmbeddingResult{Vectors: make([][]float64, 0, len(inputs))}
+	for start := 0; start < len(inputs); start += size {
+		end := min(start+size, len(inputs))
+
+		batch, err := embedBatch(inputs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(batch.Vectors) != end-start {
+			return nil, fmt.Errorf("embeddings response has %d vectors for %d inputs", len(batch.Vectors), end-start)
+		}
+
+		result.Model = batch.Model
+		result.Vectors = append(result.Vectors, batch.Vectors...)
+		result.Usage.PromptTokens += batch.Usage.PromptTokens
+		result.Usage.TotalTokens += batch.Usage.TotalTokens
+	}
+	return result, nil
+}
+
+// estimateTokens approximates the token count of texts for APIs that do not report usage
+func estimateTokens(texts []string) int {
+	tokens := 0
+	for _, text := range texts {
+		tokens += (utf8.RuneCountInString(text) + 3) / 4
+	}
+	return tokens
+}
+
+// EmbeddingModel returns the model used for embeddings when the request does not specify one
+func (p *OpenAICompatibleProvider) EmbeddingModel() string {
+	return p.cfg.DefaultEmbeddingModel
+}
+
+// embeddingsURL returns the embeddings endpoint
+func (p *OpenAICompatibleProvider) embeddingsURL() string {
+	return p.cfg.BaseURL + "/embeddings"
+}
+
+// Embeddings calls the embeddings endpoint, splitting the inputs into batches
+func (p *OpenAICompatibleProvider) Embeddings(ctx context.Context, req *models.EmbeddingRequest, apiKey string) (*EmbeddingResult, error) {
+	model := req.Model
+	if model == "" {
+		model = p.cfg.DefaultEmbeddingModel
+	}
+	if model == "" {
+		return nil, invalidRequest(p.cfg.Name, "provider %s does not support embeddings", p.cfg.Name)
+	}
+	log.Printf("%s Starting Embeddings request for model: %s (%d inputs)", p.logPrefix(), model, len(req.Input))
+
+	return embedInBatches(req.Input, p.cfg.EmbeddingBatchSize, func(batch []string) (*EmbeddingResult, error) {
+		payload := map[string]interface{}{
+			"model":           model,
+			"input":           batch,
+			"encoding_format": models.EncodingFormatFloat,
+		}
+		if req.Dimensions != nil {
+			payload["dimensions"] = *req.Dimensions
+		}
+		if req.User != "" {
+			payload["user"] = req.User
+		}
+
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+
+		var body []byte
+		err = withRetry(ctx, p.cfg.Name, p.cfg.Retry, func() error {
+			body, err = p.doRequest(ctx, "POST", p.embeddingsURL(), jsonData, apiKey)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var apiResponse struct {
+			Model string `json:"model"`
+			Data  []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+			Usage models.EmbeddingUsage `json:"usage"`
+		}
+		if err := json.Unmarshal(body, &apiResponse); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %v", err)
+		}
+
+		// Data is documented to be in input order, but sort by index to be safe
+		sort.Slice(apiResponse.Data, func(i, j int) bool {
+			return apiResponse.Data[i].Index < apiResponse.Data[j].Index
+		})
+
+		result := &EmbeddingResult{
+			Model:   apiResponse.Model,
+			Vectors: make([][]float64, len(apiResponse.Data)),
+			Usage:   apiResponse.Usage,
+		}
+		if result.Model == "" {
+			result.Model = model
+		}
+		for i, data := range apiResponse.Data {
+			result.Vectors[i] = data.Embedding
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,135 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIError is returned when a provider API responds with a non-success status
+type APIError struct {
+	Provider   string
+	StatusCode int
+	Body       string        // Raw upstream response body
+	Retryable  bool          // Whether the same request may succeed if sent again
+	RetryAfter time.Duration // Delay requested by upstream before retrying, 0 if none
+}
+
+// newAPIError creates an APIError from a failed upstream response
+func newAPIError(provider string, resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		Retryable:  retryableStatus(resp.StatusCode),
+		RetryAfter: parseRetryAfter(resp.Header),
+	}
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Message returns the error message reported by upstream, falling back to the raw body
+func (e *APIError) Message() string {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(e.Body), &body); err == nil && len(body.Error) > 0 {
+		// OpenAI and Gemini use {"error": {"message": ...}}, some providers {"error": "..."}
+		var object struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body.Error, &object); err == nil && object.Message != "" {
+			return object.Message
+		}
+		var message string
+		if err := json.Unmarshal(body.Error, &message); err == nil && message != "" {
+			return message
+		}
+	}
+
+	if body := strings.TrimSpace(e.Body); body != "" {
+		return body
+	}
+	return http.StatusText(e.StatusCode)
+}
+
+// retryableStatus reports whether an upstream status indicates a transient failure
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// RequestError is returned when a provider API could not be reached
+type RequestError struct {
+	Provider string
+	Err      error
+}
+
+// newRequestError creates a RequestError from a transport error and logs it, since
+// callers only see that the provider was unreachable. The request URL is dropped
+// from a *url.Error, since it may carry credentials.
+func newRequestError(provider string, err error) *RequestError {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	log.Printf("[%s] Request failed: %v", strings.ToUpper(provider), err)
+	return &RequestError{Provider: provider, Err: err}
+}
+
+// Error implements the error interface
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("failed to make request: %v", e.Err)
+}
+
+// Unwrap returns the underlying transport error
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// InvalidRequestError is returned when a provider cannot serve a request because
+// of its content, e.g. an unreadable image, so the caller has to fix it
+type InvalidRequestError struct {
+	Provider string
+	Message  string
+	Err      error // Upstream rejection, nil if the request was never sent
+}
+
+// invalidRequest returns an InvalidRequestError for a request rejected before it was sent
+func invalidRequest(provider, format string, args ...interface{}) error {
+	return &InvalidRequestError{Provider: provider, Message: fmt.Sprintf(format, args...)}
+}
+
+// Error implements the error interface
+func (e *InvalidRequestError) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the upstream rejection
+func (e *InvalidRequestError) Unwrap() error {
+	return e.Err
+}
+
+// UnsupportedParamsError is returned when a request sets parameters the provider cannot honor
+type UnsupportedParamsError struct {
+	Provider string
+	Params   []string
+}
+
+// Error implements the error interface
+func (e *UnsupportedParamsError) Error() string {
+	return fmt.Sprintf("provider %s does not support parameter(s): %s", e.Provider, strings.Join(e.Params, ", "))
+}
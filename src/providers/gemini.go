@@ -2,6 +2,7 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -14,12 +15,99 @@ import (
 	"encore.app/src/models"
 )
 
+// geminiBaseURL is the base URL of the Gemini models API
+const geminiBaseURL = "https://generativelanguage.googleapis.com/v1beta/models"
+
+// geminiKeyHeader carries the API key of Gemini requests
+const geminiKeyHeader = "x-goog-api-key"
+
+// geminiDefaultModel supports vision and has a large context window
+const geminiDefaultModel = "gemini-2.5-flash"
+
+// geminiUnsupportedParams are the request parameters Gemini cannot honor
+var geminiUnsupportedParams = []string{ParamLogitBias, ParamUser}
+
+// geminiModels is the static Gemini model catalog
+var geminiModels = []ModelInfo{
+	{ID: "gemini-2.5-flash", ContextWindow: 1048576, Vision: true, Tools: true, Pricing: &Pricing{Input: 0.30, Output: 2.50}},
+	{ID: "gemini-2.5-pro", ContextWindow: 1048576, Vision: true, Tools: true, Pricing: &Pricing{Input: 1.25, Output: 10.00}},
+	{ID: "gemini-2.5-flash-lite", ContextWindow: 1048576, Vision: true, Tools: true, Pricing: &Pricing{Input: 0.10, Output: 0.40}},
+	{ID: "gemini-embedding-001", ContextWindow: 2048, Pricing: &Pricing{Input: 0.15}},
+}
+
+// geminiGenerateResponse is the response body of generateContent and each event of streamGenerateContent
+type geminiGenerateResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []geminiPart `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		SafetyRatings []struct {
+			Category    string `json:"category"`
+			Probability string `json:"probability"`
+			Blocked     bool   `json:"blocked"`
+		} `json:"safetyRatings"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+// geminiContent is a turn of a Gemini conversation
+type geminiContent struct {
+	Role  string                   `json:"role"`
+	Parts []map[string]interface{} `json:"parts"`
+}
+
+// geminiRole maps an OpenAI message role to a Gemini role. Gemini only knows
+// user and model turns; system prompts map to "" and go to systemInstruction.
+func geminiRole(role string) string {
+	switch role {
+	case "system", "developer":
+		return ""
+	case "assistant", "model":
+		return "model"
+	default:
+		return "user"
+	}
+}
+
+// appendGeminiTurn appends parts as a turn of role, merging them into the last
+// turn if it has the same role since Gemini expects the roles to alternate
+func appendGeminiTurn(contents []geminiContent, role string, parts ...map[string]interface{}) []geminiContent {
+	if last := len(contents) - 1; last >= 0 && contents[last].Role == role {
+		contents[last].Parts = append(contents[last].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// checkBlocked returns an error if the prompt was blocked by safety settings
+func (r *geminiGenerateResponse) checkBlocked() error {
+	for _, rating := range r.PromptFeedback.SafetyRatings {
+		if rating.Blocked {
+			return invalidRequest("gemini", "prompt was blocked due to safety rating: category=%s, probability=%s", rating.Category, rating.Probability)
+		}
+	}
+	return nil
+}
+
 // GeminiProvider implements the Provider interface for Gemini API
-type GeminiProvider struct{}
+type GeminiProvider struct {
+	client *http.Client
+	retry  RetryPolicy
+}
 
 // NewGeminiProvider creates a new Gemini provider instance
 func NewGeminiProvider(cfg *config.Config) *GeminiProvider {
-	return &GeminiProvider{}
+	return &GeminiProvider{
+		client: &http.Client{},
+		retry:  newRetryPolicy(cfg, "gemini"),
+	}
 }
 
 // GetName returns the provider name
@@ -27,11 +115,22 @@ func (g *GeminiProvider) GetName() string {
 	return "gemini"
 }
 
+// DefaultModel returns the model used when a request does not specify one
+func (g *GeminiProvider) DefaultModel() string {
+	return geminiDefaultModel
+}
+
 // downloadImageToBase64 downloads an image from HTTP/HTTPS URL and returns base64 encoded data with MIME type
-func (g *GeminiProvider) downloadImageToBase64(url string) (string, string, error) {
-	client := &http.Client{Timeout: 30 * time.Second}
+func (g *GeminiProvider) downloadImageToBase64(ctx context.Context, url string) (string, string, error) {
+	ctx, cancel := withDefaultTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
 
-	resp, err := client.Get(url)
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create image request: %v", err)
+	}
+
+	resp, err := g.client.Do(httpReq)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to download image: %v", err)
 	}
@@ -60,19 +159,47 @@ func (g *GeminiProvider) downloadImageToBase64(url string) (string, string, erro
 	return base64Data, contentType, nil
 }
 
-// ChatCompletion calls the Gemini API for chat completion
-func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string) (*models.ChatResponse, error) {
-	// Prepare the request payload for Gemini
+// buildPayload converts a chat request into the Gemini request payload and returns it with the resolved model
+func (g *GeminiProvider) buildPayload(ctx context.Context, req *models.ChatRequest) (map[string]interface{}, string, error) {
+	// Gemini has no token biasing and no end-user field. Checked first, so a
+	// rejected request does not download its images.
+	if err := checkParams(g.GetName(), req, geminiUnsupportedParams); err != nil {
+		return nil, "", err
+	}
+
 	model := req.Model
 	if model == "" {
-		// Use a model that supports vision and has a larger context window
-		model = "gemini-2.5-flash"
+		model = geminiDefaultModel
 	}
 
 	// Validate and build contents for the Gemini API
-	geminiMessages := make([]map[string]interface{}, 0)
+	geminiMessages := make([]geminiContent, 0)
+	systemParts := make([]map[string]interface{}, 0)
+	callNames := make(map[string]string)
 	for _, msg := range req.Messages {
+		role := geminiRole(msg.Role)
 		currentMessageParts := make([]map[string]interface{}, 0)
+
+		// System prompts go to systemInstruction, Gemini has no system turns
+		if role == "" {
+			if text := msg.Text(); text != "" {
+				systemParts = append(systemParts, map[string]interface{}{
+					"text": text,
+				})
+			}
+			continue
+		}
+
+		// Tool results are sent back by the user as functionResponse parts
+		if msg.Role == "tool" {
+			part, err := geminiFunctionResponsePart(msg, callNames)
+			if err != nil {
+				return nil, "", err
+			}
+			geminiMessages = appendGeminiTurn(geminiMessages, role, part)
+			continue
+		}
+
 		for _, part := range msg.Content {
 			if part.Type == "text" {
 				currentMessageParts = append(currentMessageParts, map[string]interface{}{
@@ -88,7 +215,7 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 					// Extract base64 data and mime type from the data URI
 					partsURI := strings.SplitN(dataURI, ",", 2)
 					if len(partsURI) != 2 {
-						return nil, fmt.Errorf("invalid image data URI format")
+						return nil, "", invalidRequest(g.GetName(), "invalid image data URI format")
 					}
 					header := partsURI[0]
 					base64Data = partsURI[1]
@@ -98,12 +225,12 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 
 				} else if strings.HasPrefix(dataURI, "http://") || strings.HasPrefix(dataURI, "https://") {
 					// Download image from HTTP/HTTPS URL and convert to base64
-					base64Data, mimeType, err = g.downloadImageToBase64(dataURI)
+					base64Data, mimeType, err = g.downloadImageToBase64(ctx, dataURI)
 					if err != nil {
-						return nil, fmt.Errorf("failed to download image: %v", err)
+						return nil, "", invalidRequest(g.GetName(), "failed to download image: %v", err)
 					}
 				} else {
-					return nil, fmt.Errorf("unsupported image URL format: %s", dataURI)
+					return nil, "", invalidRequest(g.GetName(), "unsupported image URL format: %s", dataURI)
 				}
 
 				// Append inline data part if base64Data is not empty
@@ -118,23 +245,38 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 			}
 		}
 
+		// Function calls made by the assistant are replayed as functionCall parts of a model turn
+		if len(msg.ToolCalls) > 0 {
+			callParts, err := geminiFunctionCallParts(msg.ToolCalls)
+			if err != nil {
+				return nil, "", err
+			}
+			currentMessageParts = append(currentMessageParts, callParts...)
+			for _, call := range msg.ToolCalls {
+				callNames[call.ID] = call.Function.Name
+			}
+			role = "model"
+		}
+
 		if len(currentMessageParts) == 0 {
-			return nil, fmt.Errorf("no valid content found in message for role %s", msg.Role)
+			return nil, "", invalidRequest(g.GetName(), "no valid content found in message for role %s", msg.Role)
 		}
 
-		geminiMessages = append(geminiMessages, map[string]interface{}{
-			"role":  msg.Role,
-			"parts": currentMessageParts,
-		})
+		geminiMessages = appendGeminiTurn(geminiMessages, role, currentMessageParts...)
 	}
 
 	if len(geminiMessages) == 0 {
-		return nil, fmt.Errorf("no valid messages found in the request")
+		return nil, "", invalidRequest(g.GetName(), "no valid messages found in the request")
 	}
 
 	payload := map[string]interface{}{
 		"contents": geminiMessages,
 	}
+	if len(systemParts) > 0 {
+		payload["systemInstruction"] = map[string]interface{}{
+			"parts": systemParts,
+		}
+	}
 
 	// Add generation config if temperature or max tokens are specified
 	generationConfig := make(map[string]interface{})
@@ -147,6 +289,35 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 		// Set a reasonable default if not specified to avoid early termination
 		generationConfig["maxOutputTokens"] = 2048
 	}
+	if req.TopP != nil {
+		generationConfig["topP"] = *req.TopP
+	}
+	if req.TopK != nil {
+		generationConfig["topK"] = *req.TopK
+	}
+	if len(req.Stop) > 0 {
+		generationConfig["stopSequences"] = req.Stop
+	}
+	if req.Seed != nil {
+		generationConfig["seed"] = *req.Seed
+	}
+	if req.PresencePenalty != nil {
+		generationConfig["presencePenalty"] = *req.PresencePenalty
+	}
+	if req.FrequencyPenalty != nil {
+		generationConfig["frequencyPenalty"] = *req.FrequencyPenalty
+	}
+	if req.N != nil {
+		generationConfig["candidateCount"] = *req.N
+	}
+
+	// Structured output, the schema is passed as JSON Schema rather than Gemini's OpenAPI subset
+	if format := req.ResponseFormat; format != nil && format.Type != models.ResponseFormatText {
+		generationConfig["responseMimeType"] = "application/json"
+		if format.JSONSchema != nil && len(format.JSONSchema.Schema) > 0 {
+			generationConfig["responseJsonSchema"] = format.JSONSchema.Schema
+		}
+	}
 	if len(generationConfig) > 0 {
 		payload["generationConfig"] = generationConfig
 	}
@@ -174,36 +345,34 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 
 	// Add tools if specified in the request
 	if len(req.Tools) > 0 {
-		var tools []map[string]interface{}
-		for range req.Tools {
-			tools = append(tools, map[string]interface{}{
-				"google_search": map[string]interface{}{},
-			})
+		payload["tools"] = geminiTools(req.Tools)
+		if req.ToolChoice != nil {
+			payload["toolConfig"] = geminiToolConfig(req.ToolChoice)
 		}
-		payload["tools"] = tools
 	}
 
-	// Convert to JSON
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
-	}
+	return payload, model, nil
+}
+
+// doRequest sends a single request to the Gemini API and returns the response body
+func (g *GeminiProvider) doRequest(ctx context.Context, method, url string, jsonData []byte, apiKey string) ([]byte, error) {
+	// Bound the call by the caller's deadline or the default timeout
+	ctx, cancel := withDefaultTimeout(ctx, DefaultRequestTimeout)
+	defer cancel()
 
 	// Create HTTP request
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s", model, apiKey)
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
-	// Set headers
+	// Set headers; the key goes in a header so that it never shows up in a logged URL
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(geminiKeyHeader, apiKey)
 
-	// Make the request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(httpReq)
+	resp, err := g.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %v", err)
+		return nil, newRequestError(g.GetName(), err)
 	}
 	defer resp.Body.Close()
 
@@ -214,44 +383,46 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError(g.GetName(), resp, body)
 	}
 
-	// Parse Gemini response
-	var geminiResponse struct {
-		Candidates []struct {
-			Content struct {
-				Parts []struct {
-					Text string `json:"text"`
-				} `json:"parts"`
-			} `json:"content"`
-			FinishReason string `json:"finishReason"`
-		} `json:"candidates"`
-		PromptFeedback struct {
-			SafetyRatings []struct {
-				Category    string `json:"category"`
-				Probability string `json:"probability"`
-				Blocked     bool   `json:"blocked"`
-			} `json:"safetyRatings"`
-		} `json:"promptFeedback"`
-		UsageMetadata struct {
-			PromptTokenCount     int `json:"promptTokenCount"`
-			CandidatesTokenCount int `json:"candidatesTokenCount"`
-			TotalTokenCount      int `json:"totalTokenCount"`
-		} `json:"usageMetadata"`
+	return body, nil
+}
+
+// ChatCompletion calls the Gemini API for chat completion
+func (g *GeminiProvider) ChatCompletion(ctx context.Context, req *models.ChatRequest, apiKey string) (*models.ChatResponse, error) {
+	// Prepare the request payload for Gemini
+	payload, model, err := g.buildPayload(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to JSON
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	// Make the request, retrying transient failures
+	url := fmt.Sprintf("%s/%s:generateContent", geminiBaseURL, model)
+	var body []byte
+	err = withRetry(ctx, g.GetName(), g.retry, func() error {
+		body, err = g.doRequest(ctx, "POST", url, jsonData, apiKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	// Parse Gemini response
+	var geminiResponse geminiGenerateResponse
 	if err := json.Unmarshal(body, &geminiResponse); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
 
 	// Check if the prompt was blocked by safety settings
-	if geminiResponse.PromptFeedback.SafetyRatings != nil {
-		for _, rating := range geminiResponse.PromptFeedback.SafetyRatings {
-			if rating.Blocked {
-				return nil, fmt.Errorf("prompt was blocked due to safety rating: category=%s, probability=%s", rating.Category, rating.Probability)
-			}
-		}
+	if err := geminiResponse.checkBlocked(); err != nil {
+		return nil, err
 	}
 
 	// Handle case where no candidates are returned
@@ -261,7 +432,7 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 
 	// Convert to our response format
 	response := &models.ChatResponse{
-		ID:      fmt.Sprintf("gemini-%d", time.Now().Unix()),
+		ID:      fmt.Sprintf("gemini-%d", time.Now().UnixNano()),
 		Object:  "chat.completion",
 		Created: time.Now().Unix(),
 		Model:   model,
@@ -274,15 +445,16 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 	}
 
 	for i, candidate := range geminiResponse.Candidates {
-		content := ""
-		if len(candidate.Content.Parts) > 0 && candidate.Content.Parts[0].Text != "" {
-			content = candidate.Content.Parts[0].Text
-		}
+		content := geminiText(candidate.Content.Parts)
+		toolCalls := geminiToolCalls(fmt.Sprintf("%s_%d", response.ID, i), candidate.Content.Parts, 0, false)
 
 		finishReason := strings.ToLower(candidate.FinishReason)
 		if finishReason == "max_tokens" && len(candidate.Content.Parts) == 0 {
 			content = "The response was terminated early due to the 'max_tokens' limit. Please try increasing the max_tokens parameter."
 		}
+		if len(toolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
 
 		response.Choices[i] = models.Choice{
 			Index: i,
@@ -294,6 +466,7 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 						Text: content,
 					},
 				},
+				ToolCalls: toolCalls,
 			},
 			FinishReason: finishReason,
 		}
@@ -301,3 +474,134 @@ func (g *GeminiProvider) ChatCompletion(req *models.ChatRequest, apiKey string)
 
 	return response, nil
 }
+
+// Catalog returns the static model catalog
+func (g *GeminiProvider) Catalog() []ModelInfo {
+	return geminiModels
+}
+
+// ListModels lists the Gemini models that support generateContent
+func (g *GeminiProvider) ListModels(ctx context.Context, apiKey string) ([]ModelInfo, error) {
+	url := fmt.Sprintf("%s?pageSize=1000", geminiBaseURL)
+	body, err := g.doRequest(ctx, "GET", url, nil, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var listResponse struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			InputTokenLimit            int      `json:"inputTokenLimit"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &listResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %v", err)
+	}
+
+	modelList := make([]ModelInfo, 0, len(listResponse.Models))
+	for _, model := range listResponse.Models {
+		for _, method := range model.SupportedGenerationMethods {
+			if method == "generateContent" {
+				modelList = append(modelList, ModelInfo{
+					ID:            strings.TrimPrefix(model.Name, "models/"),
+					ContextWindow: model.InputTokenLimit,
+				})
+				break
+			}
+		}
+	}
+	return modelList, nil
+}
+
+// ChatCompletionStream streams a chat completion from the Gemini streamGenerateContent API
+func (g *GeminiProvider) ChatCompletionStream(ctx context.Context, req *models.ChatRequest, apiKey string, onChunk ChunkHandler) error {
+	payload, model, err := g.buildPayload(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	// Only opening the stream is retried, once chunks flow a failure is final
+	url := fmt.Sprintf("%s/%s:streamGenerateContent?alt=sse", geminiBaseURL, model)
+	var resp *http.Response
+	err = withRetry(ctx, g.GetName(), g.retry, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set(geminiKeyHeader, apiKey)
+
+		resp, err = openStream(g.GetName(), httpReq)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	id := fmt.Sprintf("gemini-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+	first := true
+	callCounts := make(map[int]int) // tool calls emitted so far per candidate
+
+	return readSSE(resp.Body, func(data []byte) error {
+		var geminiResponse geminiGenerateResponse
+		if err := json.Unmarshal(data, &geminiResponse); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %v", err)
+		}
+		if err := geminiResponse.checkBlocked(); err != nil {
+			return err
+		}
+
+		chunk := &models.ChatCompletionChunk{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: make([]models.ChunkChoice, len(geminiResponse.Candidates)),
+		}
+
+		finished := false
+		for i, candidate := range geminiResponse.Candidates {
+			toolCalls := geminiToolCalls(fmt.Sprintf("%s_%d", id, i), candidate.Content.Parts, callCounts[i], true)
+			callCounts[i] += len(toolCalls)
+
+			chunk.Choices[i] = models.ChunkChoice{
+				Index: i,
+				Delta: models.ChunkDelta{
+					Content:   geminiText(candidate.Content.Parts),
+					ToolCalls: toolCalls,
+				},
+			}
+			if first {
+				chunk.Choices[i].Delta.Role = "assistant"
+			}
+			if candidate.FinishReason != "" {
+				finishReason := strings.ToLower(candidate.FinishReason)
+				if callCounts[i] > 0 {
+					finishReason = "tool_calls"
+				}
+				chunk.Choices[i].FinishReason = &finishReason
+				finished = true
+			}
+		}
+		first = false
+
+		// Gemini reports cumulative usage on every event, only forward it with the final one
+		if usage := geminiResponse.UsageMetadata; finished && usage.TotalTokenCount > 0 {
+			chunk.Usage = &models.Usage{
+				PromptTokens:     usage.PromptTokenCount,
+				CompletionTokens: usage.CandidatesTokenCount,
+				TotalTokens:      usage.TotalTokenCount,
+			}
+		}
+
+		return onChunk(chunk)
+	})
+}
@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"encore.app/src/models"
+)
+
+// Gemini embedding defaults
+const (
+	geminiDefaultEmbeddingModel = "gemini-embedding-001"
+	geminiEmbeddingBatchSize    = 100 // Maximum number of requests per batchEmbedContents call
+)
+
+// EmbeddingModel returns the model used for embeddings when the request does not specify one
+func (g *GeminiProvider) EmbeddingModel() string {
+	return geminiDefaultEmbeddingModel
+}
+
+// Embeddings embeds the inputs with batchEmbedContents, which also serves single inputs.
+// Gemini does not report token usage for embeddings, so it is estimated.
+func (g *GeminiProvider) Embeddings(ctx context.Context, req *models.EmbeddingRequest, apiKey string) (*EmbeddingResult, error) {
+	model := req.Model
+	if model == "" {
+		model = geminiDefaultEmbeddingModel
+	}
+	if req.User != "" {
+		return nil, &UnsupportedParamsError{Provider: g.GetName(), Params: []string{ParamUser}}
+	}
+
+	url := fmt.Sprintf("%s/%s:batchEmbedContents", geminiBaseURL, model)
+	return embedInBatches(req.Input, geminiEmbeddingBatchSize, func(batch []string) (*EmbeddingResult, error) {
+		requests := make([]map[string]interface{}, 0, len(batch))
+		for _, text := range batch {
+			request := map[string]interface{}{
+				"model": "models/" + model,
+				"content": map[string]interface{}{
+					"parts": []map[string]interface{}{
+						{"text": text},
+					},
+				},
+			}
+			if req.Dimensions != nil {
+				request["outputDimensionality"] = *req.Dimensions
+			}
+			requests = append(requests, request)
+		}
+
+		jsonData, err := json.Marshal(map[string]interface{}{"requests": requests})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+
+		var body []byte
+		err = withRetry(ctx, g.GetName(), g.retry, func() error {
+			body, err = g.doRequest(ctx, "POST", url, jsonData, apiKey)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var geminiResponse struct {
+			Embeddings []struct {
+				Values []float64 `json:"values"`
+			} `json:"embeddings"`
+		}
+		if err := json.Unmarshal(body, &geminiResponse); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %v", err)
+		}
+
+		tokens := estimateTokens(batch)
+		result := &EmbeddingResult{
+			Model:   model,
+			Vectors: make([][]float64, len(geminiResponse.Embeddings)),
+			Usage: models.EmbeddingUsage{
+				PromptTokens: tokens,
+				TotalTokens:  tokens,
+			},
+		}
+		for i, embedding := range geminiResponse.Embeddings {
+			result.Vectors[i] = embedding.Values
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+func TestGeminiChecksParamsBeforeDownloadingImages(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		user          string
+		wantErr       bool
+		wantDownloads int
+	}{
+		{"supported parameters", "", false, 1},
+		{"unsupported parameter", "user-1", true, 0},
+	}
+
+	g := NewGeminiProvider(&config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downloads = 0
+			req := &models.ChatRequest{
+				User: tt.user,
+				Messages: []models.ChatMessage{{Role: "user", Content: []models.ContentPart{
+					{Type: "text", Text: "what is this?"},
+					{Type: "image_url", ImageURL: &models.ImageURL{URL: server.URL + "/image.png"}},
+				}}},
+			}
+
+			_, _, err := g.buildPayload(context.Background(), req)
+			var paramsErr *UnsupportedParamsError
+			if tt.wantErr != errors.As(err, &paramsErr) {
+				t.Fatalf("got error %v, want unsupported parameters %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if downloads != tt.wantDownloads {
+				t.Errorf("%d image downloads, want %d", downloads, tt.wantDownloads)
+			}
+		})
+	}
+}
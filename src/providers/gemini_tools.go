@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"encore.app/src/models"
+)
+
+// geminiPart is a content part of a Gemini response
+type geminiPart struct {
+	Text         string `json:"text"`
+	FunctionCall *struct {
+		Name string          `json:"name"`
+		Args json.RawMessage `json:"args"`
+	} `json:"functionCall"`
+}
+
+// geminiTools converts request tools into Gemini tools: function tools become
+// functionDeclarations, any other tool enables Google Search
+func geminiTools(tools []models.Tool) []map[string]interface{} {
+	var result []map[string]interface{}
+
+	declarations := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		if !tool.IsFunction() {
+			result = append(result, map[string]interface{}{
+				"google_search": map[string]interface{}{},
+			})
+			continue
+		}
+
+		declaration := map[string]interface{}{
+			"name": tool.Function.Name,
+		}
+		if tool.Function.Description != "" {
+			declaration["description"] = tool.Function.Description
+		}
+		if len(tool.Function.Parameters) > 0 {
+			declaration["parametersJsonSchema"] = tool.Function.Parameters
+		}
+		declarations = append(declarations, declaration)
+	}
+
+	if len(declarations) > 0 {
+		result = append(result, map[string]interface{}{
+			"functionDeclarations": declarations,
+		})
+	}
+	return result
+}
+
+// geminiToolConfig converts an OpenAI tool choice into a Gemini toolConfig
+func geminiToolConfig(choice *models.ToolChoice) map[string]interface{} {
+	callingConfig := map[string]interface{}{}
+
+	switch {
+	case choice.Function != "":
+		callingConfig["mode"] = "ANY"
+		callingConfig["allowedFunctionNames"] = []string{choice.Function}
+	case choice.Mode == models.ToolChoiceRequired:
+		callingConfig["mode"] = "ANY"
+	case choice.Mode == models.ToolChoiceNone:
+		callingConfig["mode"] = "NONE"
+	default:
+		callingConfig["mode"] = "AUTO"
+	}
+
+	return map[string]interface{}{
+		"functionCallingConfig": callingConfig,
+	}
+}
+
+// geminiFunctionCallParts converts assistant tool calls into Gemini functionCall parts
+func geminiFunctionCallParts(calls []models.ToolCall) ([]map[string]interface{}, error) {
+	parts := make([]map[string]interface{}, 0, len(calls))
+	for _, call := range calls {
+		args := map[string]interface{}{}
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+				return nil, invalidRequest("gemini", "invalid arguments for tool call %s: %v", call.ID, err)
+			}
+		}
+
+		parts = append(parts, map[string]interface{}{
+			"functionCall": map[string]interface{}{
+				"name": call.Function.Name,
+				"args": args,
+			},
+		})
+	}
+	return parts, nil
+}
+
+// geminiFunctionResponsePart converts a "tool" message into a Gemini functionResponse part.
+// Gemini identifies calls by function name, so the name is looked up from the call ID.
+func geminiFunctionResponsePart(msg models.ChatMessage, callNames map[string]string) (map[string]interface{}, error) {
+	name := msg.Name
+	if name == "" {
+		name = callNames[msg.ToolCallID]
+	}
+	if name == "" {
+		return nil, invalidRequest("gemini", "tool message references unknown tool call: %s", msg.ToolCallID)
+	}
+
+	// The response must be an object, wrap anything else
+	text := msg.Text()
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &response); err != nil {
+		response = map[string]interface{}{"content": text}
+	}
+
+	return map[string]interface{}{
+		"functionResponse": map[string]interface{}{
+			"name":     name,
+			"response": response,
+		},
+	}, nil
+}
+
+// geminiToolCalls converts Gemini functionCall parts into OpenAI tool calls.
+// Gemini has no call IDs, so they are derived from the response ID and position;
+// offset is the number of calls already emitted for the response. Stream deltas
+// also carry the position as index.
+func geminiToolCalls(id string, parts []geminiPart, offset int, withIndex bool) []models.ToolCall {
+	var calls []models.ToolCall
+	for _, part := range parts {
+		if part.FunctionCall == nil {
+			continue
+		}
+
+		args := string(part.FunctionCall.Args)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+
+		position := offset + len(calls)
+		call := models.ToolCall{
+			ID:   fmt.Sprintf("call_%s_%d", id, position),
+			Type: "function",
+			Function: models.FunctionCall{
+				Name:      part.FunctionCall.Name,
+				Arguments: args,
+			},
+		}
+		if withIndex {
+			call.Index = &position
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// geminiText concatenates the text parts of a Gemini response
+func geminiText(parts []geminiPart) string {
+	text := ""
+	for _, part := range parts {
+		text += part.Text
+	}
+	return text
+}
@@ -0,0 +1,424 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"encore.app/src/models"
+)
+
+// AuthScheme defines how the API key is sent to an OpenAI-compatible API
+type AuthScheme string
+
+const (
+	// AuthSchemeBearer sends the key as "Authorization: Bearer <key>"
+	AuthSchemeBearer AuthScheme = "bearer"
+	// AuthSchemeHeader sends the key as-is in the header named by AuthHeader
+	AuthSchemeHeader AuthScheme = "header"
+	// AuthSchemeNone sends no credentials, e.g. for a local inference server
+	AuthSchemeNone AuthScheme = "none"
+)
+
+// OpenAICompatibleConfig describes an API that implements the OpenAI chat completions protocol
+type OpenAICompatibleConfig struct {
+	Name               string            // Provider name used for registration and logging
+	BaseURL            string            // Base URL without trailing slash, e.g. https://api.groq.com/openai/v1
+	DefaultModel       string            // Model used when the request does not specify one
+	DefaultVisionModel string            // Model used for image requests, falls back to DefaultModel
+	Headers            map[string]string // Extra headers sent with every request
+	AuthScheme         AuthScheme        // How the API key is sent, defaults to AuthSchemeBearer
+	AuthHeader         string            // Header name used with AuthSchemeHeader
+	Timeout            time.Duration     // Request timeout when the caller sets no deadline, defaults to DefaultRequestTimeout
+	Retry              RetryPolicy       // Retry policy for failed calls, defaults to DefaultRetryPolicy
+	Models             []ModelInfo       // Static model catalog
+	UnsupportedParams  []string          // Optional request parameters the API rejects or ignores, defaults to defaultUnsupportedParams
+
+	DefaultEmbeddingModel string // Model used for embeddings when the request does not specify one, empty if the API cannot embed
+	EmbeddingBatchSize    int    // Inputs per embeddings call, defaults to DefaultEmbeddingBatchSize
+}
+
+// OpenAICompatibleProvider implements the Provider interface for any OpenAI-compatible API
+type OpenAICompatibleProvider struct {
+	cfg    OpenAICompatibleConfig
+	client *http.Client
+}
+
+// NewOpenAICompatibleProvider creates a new OpenAI-compatible provider instance
+func NewOpenAICompatibleProvider(cfg OpenAICompatibleConfig) *OpenAICompatibleProvider {
+	cfg.BaseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	if cfg.AuthScheme == "" {
+		cfg.AuthScheme = AuthSchemeBearer
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultRequestTimeout
+	}
+	if cfg.Retry.MaxAttempts == 0 {
+		cfg.Retry = DefaultRetryPolicy
+	}
+	if cfg.UnsupportedParams == nil {
+		cfg.UnsupportedParams = defaultUnsupportedParams
+	}
+	if cfg.EmbeddingBatchSize <= 0 {
+		cfg.EmbeddingBatchSize = DefaultEmbeddingBatchSize
+	}
+
+	return &OpenAICompatibleProvider{
+		cfg:    cfg,
+		client: &http.Client{},
+	}
+}
+
+// GetName returns the provider name
+func (p *OpenAICompatibleProvider) GetName() string {
+	return p.cfg.Name
+}
+
+// DefaultModel returns the model used when a request does not specify one
+func (p *OpenAICompatibleProvider) DefaultModel() string {
+	return p.cfg.DefaultModel
+}
+
+// logPrefix returns the log prefix for this provider, e.g. [GROQ]
+func (p *OpenAICompatibleProvider) logPrefix() string {
+	return "[" + strings.ToUpper(p.cfg.Name) + "]"
+}
+
+// chatURL returns the chat completions endpoint
+func (p *OpenAICompatibleProvider) chatURL() string {
+	return p.cfg.BaseURL + "/chat/completions"
+}
+
+// modelsURL returns the model list endpoint
+func (p *OpenAICompatibleProvider) modelsURL() string {
+	return p.cfg.BaseURL + "/models"
+}
+
+// headers returns the headers for a request authenticated with apiKey
+func (p *OpenAICompatibleProvider) headers(apiKey string) map[string]string {
+	headers := make(map[string]string, len(p.cfg.Headers)+1)
+	for key, value := range p.cfg.Headers {
+		headers[key] = value
+	}
+
+	switch p.cfg.AuthScheme {
+	case AuthSchemeBearer:
+		headers["Authorization"] = "Bearer " + apiKey
+	case AuthSchemeHeader:
+		headers[p.cfg.AuthHeader] = apiKey
+	}
+
+	return headers
+}
+
+// resolveModel returns the requested model or the configured default
+func (p *OpenAICompatibleProvider) resolveModel(req *models.ChatRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	if req.WithImage && p.cfg.DefaultVisionModel != "" {
+		return p.cfg.DefaultVisionModel
+	}
+	return p.cfg.DefaultModel
+}
+
+// buildPayload converts a chat request into the OpenAI request payload
+func (p *OpenAICompatibleProvider) buildPayload(req *models.ChatRequest) (map[string]interface{}, error) {
+	if err := checkParams(p.cfg.Name, req, p.cfg.UnsupportedParams); err != nil {
+		return nil, err
+	}
+
+	messages := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		contentParts := make([]map[string]interface{}, 0, len(msg.Content))
+		for _, part := range msg.Content {
+			if part.Type == "text" {
+				contentParts = append(contentParts, map[string]interface{}{
+					"type": "text",
+					"text": part.Text,
+				})
+			} else if part.Type == "image_url" && part.ImageURL != nil {
+				if strings.TrimSpace(part.ImageURL.URL) == "" {
+					return nil, invalidRequest(p.cfg.Name, "empty image URL provided")
+				}
+
+				contentParts = append(contentParts, map[string]interface{}{
+					"type": "image_url",
+					"image_url": map[string]interface{}{
+						"url": part.ImageURL.URL,
+					},
+				})
+			}
+		}
+		message := map[string]interface{}{
+			"role":    msg.Role,
+			"content": contentParts,
+		}
+
+		// Only user messages may carry content parts everywhere, other roles get plain text
+		if msg.Role != "user" {
+			message["content"] = msg.Text()
+		}
+		if len(msg.ToolCalls) > 0 {
+			message["tool_calls"] = msg.ToolCalls
+			if len(contentParts) == 0 {
+				message["content"] = nil
+			}
+		}
+		if msg.ToolCallID != "" {
+			message["tool_call_id"] = msg.ToolCallID
+		}
+		if msg.Name != "" {
+			message["name"] = msg.Name
+		}
+
+		messages = append(messages, message)
+	}
+
+	payload := map[string]interface{}{
+		"model":    p.resolveModel(req),
+		"messages": messages,
+	}
+
+	// Pass function tools through, other tool types (e.g. Google Search) are Gemini only
+	tools := make([]map[string]interface{}, 0, len(req.Tools))
+	for _, tool := range req.Tools {
+		if tool.IsFunction() {
+			tools = append(tools, map[string]interface{}{
+				"type":     "function",
+				"function": tool.Function,
+			})
+		}
+	}
+	if len(tools) > 0 {
+		payload["tools"] = tools
+		if req.ToolChoice != nil {
+			payload["tool_choice"] = req.ToolChoice
+		}
+	}
+
+	if req.ResponseFormat != nil {
+		payload["response_format"] = req.ResponseFormat
+	}
+
+	if req.Temperature != nil {
+		payload["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens != nil {
+		payload["max_tokens"] = *req.MaxTokens
+	}
+	if req.TopP != nil {
+		payload["top_p"] = *req.TopP
+	}
+	if req.TopK != nil {
+		payload["top_k"] = *req.TopK
+	}
+	if len(req.Stop) > 0 {
+		payload["stop"] = req.Stop
+	}
+	if req.Seed != nil {
+		payload["seed"] = *req.Seed
+	}
+	if req.PresencePenalty != nil {
+		payload["presence_penalty"] = *req.PresencePenalty
+	}
+	if req.FrequencyPenalty != nil {
+		payload["frequency_penalty"] = *req.FrequencyPenalty
+	}
+	if req.N != nil {
+		payload["n"] = *req.N
+	}
+	if len(req.LogitBias) > 0 {
+		payload["logit_bias"] = req.LogitBias
+	}
+	if req.User != "" {
+		payload["user"] = req.User
+	}
+
+	return payload, nil
+}
+
+// doRequest sends a single request to the API and returns the response body
+func (p *OpenAICompatibleProvider) doRequest(ctx context.Context, method, url string, jsonData []byte, apiKey string) ([]byte, error) {
+	// Bound the call by the caller's deadline or the provider timeout
+	ctx, cancel := withDefaultTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	// Set headers
+	httpReq.Header.Set("Content-Type", "application/json")
+	for key, value := range p.headers(apiKey) {
+		httpReq.Header.Set(key, value)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, newRequestError(p.cfg.Name, err)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(p.cfg.Name, resp, body)
+	}
+
+	return body, nil
+}
+
+// ChatCompletion calls the chat completions endpoint
+func (p *OpenAICompatibleProvider) ChatCompletion(ctx context.Context, req *models.ChatRequest, apiKey string) (*models.ChatResponse, error) {
+	log.Printf("%s Starting ChatCompletion request for model: %s", p.logPrefix(), p.resolveModel(req))
+
+	// Prepare the request payload
+	payload, err := p.buildPayload(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to JSON
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	// Make the request, retrying transient failures
+	var body []byte
+	err = withRetry(ctx, p.cfg.Name, p.cfg.Retry, func() error {
+		body, err = p.doRequest(ctx, "POST", p.chatURL(), jsonData, apiKey)
+		return err
+	})
+	if err != nil {
+		log.Printf("%s API request failed for model %s: %v", p.logPrefix(), payload["model"], err)
+
+		// Check if the error is specifically about media/image access
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest && strings.Contains(apiErr.Body, "failed to retrieve media") {
+			return nil, &InvalidRequestError{Provider: p.cfg.Name, Message: "image access error: " + apiErr.Message(), Err: apiErr}
+		}
+
+		return nil, err
+	}
+
+	// Parse response
+	var apiResponse struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Index   int `json:"index"`
+			Message struct {
+				Role      string            `json:"role"`
+				Content   string            `json:"content"`
+				ToolCalls []models.ToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+			TotalTokens      int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+
+	if err := json.Unmarshal(body, &apiResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	// Convert to our response format
+	response := &models.ChatResponse{
+		ID:      apiResponse.ID,
+		Object:  apiResponse.Object,
+		Created: apiResponse.Created,
+		Model:   apiResponse.Model,
+		Choices: make([]models.Choice, len(apiResponse.Choices)),
+		Usage: models.Usage{
+			PromptTokens:     apiResponse.Usage.PromptTokens,
+			CompletionTokens: apiResponse.Usage.CompletionTokens,
+			TotalTokens:      apiResponse.Usage.TotalTokens,
+		},
+	}
+
+	for i, choice := range apiResponse.Choices {
+		response.Choices[i] = models.Choice{
+			Index: choice.Index,
+			Message: models.ChatMessage{
+				Role: choice.Message.Role,
+				Content: []models.ContentPart{
+					{
+						Type: "text",
+						Text: choice.Message.Content,
+					},
+				},
+				ToolCalls: choice.Message.ToolCalls,
+			},
+			FinishReason: choice.FinishReason,
+		}
+	}
+
+	return response, nil
+}
+
+// ChatCompletionStream streams a chat completion from the chat completions endpoint
+func (p *OpenAICompatibleProvider) ChatCompletionStream(ctx context.Context, req *models.ChatRequest, apiKey string, onChunk ChunkHandler) error {
+	payload, err := p.buildPayload(req)
+	if err != nil {
+		return err
+	}
+
+	return streamOpenAICompatible(ctx, p.cfg.Name, p.cfg.Retry, p.chatURL(), p.headers(apiKey), payload, onChunk)
+}
+
+// Catalog returns the static model catalog
+func (p *OpenAICompatibleProvider) Catalog() []ModelInfo {
+	return p.cfg.Models
+}
+
+// ListModels lists the models served by the API
+func (p *OpenAICompatibleProvider) ListModels(ctx context.Context, apiKey string) ([]ModelInfo, error) {
+	body, err := p.doRequest(ctx, "GET", p.modelsURL(), nil, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Groq reports context_window, OpenRouter context_length
+	var listResponse struct {
+		Data []struct {
+			ID            string `json:"id"`
+			ContextWindow int    `json:"context_window"`
+			ContextLength int    `json:"context_length"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &listResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %v", err)
+	}
+
+	modelList := make([]ModelInfo, 0, len(listResponse.Data))
+	for _, model := range listResponse.Data {
+		info := ModelInfo{
+			ID:            model.ID,
+			ContextWindow: model.ContextWindow,
+		}
+		if info.ContextWindow == 0 {
+			info.ContextWindow = model.ContextLength
+		}
+		modelList = append(modelList, info)
+	}
+	return modelList, nil
+}
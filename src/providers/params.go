@@ -0,0 +1,54 @@
+package providers
+
+import (
+	"encore.app/src/models"
+)
+
+// Optional sampling parameters, named as in the OpenAI request
+const (
+	ParamTopP             = "top_p"
+	ParamTopK             = "top_k"
+	ParamStop             = "stop"
+	ParamSeed             = "seed"
+	ParamPresencePenalty  = "presence_penalty"
+	ParamFrequencyPenalty = "frequency_penalty"
+	ParamN                = "n"
+	ParamLogitBias        = "logit_bias"
+	ParamUser             = "user"
+)
+
+// defaultUnsupportedParams are the parameters OpenAI-compatible providers lack unless configured
+// otherwise; top_k is not part of the OpenAI protocol
+var defaultUnsupportedParams = []string{ParamTopK}
+
+// requestedParams returns the optional sampling parameters set on req. n only
+// counts when more than one choice is requested.
+func requestedParams(req *models.ChatRequest) map[string]bool {
+	return map[string]bool{
+		ParamTopP:             req.TopP != nil,
+		ParamTopK:             req.TopK != nil,
+		ParamStop:             len(req.Stop) > 0,
+		ParamSeed:             req.Seed != nil,
+		ParamPresencePenalty:  req.PresencePenalty != nil,
+		ParamFrequencyPenalty: req.FrequencyPenalty != nil,
+		ParamN:                req.N != nil && *req.N > 1,
+		ParamLogitBias:        len(req.LogitBias) > 0,
+		ParamUser:             req.User != "",
+	}
+}
+
+// checkParams returns an UnsupportedParamsError if req sets any of the unsupported parameters
+func checkParams(provider string, req *models.ChatRequest, unsupported []string) error {
+	requested := requestedParams(req)
+
+	var params []string
+	for _, param := range unsupported {
+		if requested[param] {
+			params = append(params, param)
+		}
+	}
+	if len(params) > 0 {
+		return &UnsupportedParamsError{Provider: provider, Params: params}
+	}
+	return nil
+}
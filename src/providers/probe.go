@@ -0,0 +1,140 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"encore.app/src/models"
+)
+
+// ProbeTimeout bounds a provider probe
+const ProbeTimeout = 15 * time.Second
+
+// Probe failure reasons
+const (
+	FailureInvalidKey     = "invalid_key"
+	FailureQuotaExhausted = "quota_exhausted"
+	FailureRateLimited    = "rate_limited"
+	FailureModelNotFound  = "model_not_found"
+	FailureNetwork        = "network"
+	FailureTimeout        = "timeout"
+	FailureUpstream       = "upstream_error"
+	FailureBadRequest     = "bad_request"
+	FailureUnknown        = "unknown"
+)
+
+// ProbeResult is the outcome of a provider probe
+type ProbeResult struct {
+	Model      string        // Model the probe was sent to
+	Latency    time.Duration // Time until the provider answered or the call failed
+	StatusCode int           // Upstream HTTP status, 0 if no response was received
+	Reason     string        // Classified failure reason, empty on success
+	Err        error
+}
+
+// defaultModeler is implemented by providers that expose their default model
+type defaultModeler interface {
+	DefaultModel() string
+}
+
+// DefaultModel returns the chat model a provider uses when a request names none, empty if unknown
+func DefaultModel(provider Provider) string {
+	if modeler, ok := unwrapProvider(provider).(defaultModeler); ok {
+		return modeler.DefaultModel()
+	}
+	return ""
+}
+
+// Probe sends a tiny chat completion to a provider to check that it is reachable
+// and accepts apiKey. It bypasses the circuit breaker and retries so the result
+// reflects a single real call, e.g. right after a key rotation.
+func Probe(ctx context.Context, name, model, apiKey string) *ProbeResult {
+	provider, err := GetProvider(name)
+	if err != nil {
+		return &ProbeResult{Model: model, Reason: FailureUnknown, Err: err}
+	}
+	provider = unwrapProvider(provider)
+	if model == "" {
+		model = DefaultModel(provider)
+	}
+
+	ctx, cancel := context.WithTimeout(withoutRetries(ctx), ProbeTimeout)
+	defer cancel()
+
+	maxTokens := 8
+	temperature := 0.0
+	req := &models.ChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{
+				Role:    "user",
+				Content: []models.ContentPart{{Type: "text", Text: "ping"}},
+			},
+		},
+		MaxTokens:   &maxTokens,
+		Temperature: &temperature,
+	}
+
+	start := time.Now()
+	response, err := provider.ChatCompletion(ctx, req, apiKey)
+	result := &ProbeResult{
+		Model:   model,
+		Latency: time.Since(start),
+	}
+
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			result.StatusCode = apiErr.StatusCode
+		}
+		result.Reason = ClassifyFailure(ctx, err)
+		result.Err = err
+		return result
+	}
+
+	result.StatusCode = http.StatusOK
+	if response.Model != "" {
+		result.Model = response.Model
+	}
+	return result
+}
+
+// ClassifyFailure maps a provider error to one of the Failure* reasons
+func ClassifyFailure(ctx context.Context, err error) string {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return FailureTimeout
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		body := strings.ToLower(apiErr.Body)
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized, apiErr.StatusCode == http.StatusForbidden:
+			return FailureInvalidKey
+		// Gemini rejects a bad key with 400 API_KEY_INVALID
+		case strings.Contains(body, "api_key_invalid"), strings.Contains(body, "api key not valid"), strings.Contains(body, "invalid api key"):
+			return FailureInvalidKey
+		case apiErr.StatusCode == http.StatusPaymentRequired,
+			strings.Contains(body, "quota"), strings.Contains(body, "insufficient_credits"), strings.Contains(body, "billing"):
+			return FailureQuotaExhausted
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return FailureRateLimited
+		case apiErr.StatusCode == http.StatusNotFound,
+			strings.Contains(body, "model") && (strings.Contains(body, "not found") || strings.Contains(body, "does not exist") || strings.Contains(body, "not a valid model")):
+			return FailureModelNotFound
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			return FailureUpstream
+		default:
+			return FailureBadRequest
+		}
+	}
+
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return FailureNetwork
+	}
+	return FailureUnknown
+}
@@ -1,8 +1,10 @@
 package providers
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"encore.app/src/config"
 	"encore.app/src/models"
@@ -11,19 +13,61 @@ import (
 // Provider interface defines the methods that each AI provider must implement.
 type Provider interface {
 	GetName() string
-	ChatCompletion(req *models.ChatRequest, apiKey string) (*models.ChatResponse, error)
+	ChatCompletion(ctx context.Context, req *models.ChatRequest, apiKey string) (*models.ChatResponse, error)
+}
+
+// ChunkHandler is called for every chunk of a streamed completion.
+// Returning an error stops the stream.
+type ChunkHandler func(chunk *models.ChatCompletionChunk) error
+
+// StreamingProvider is implemented by providers that can stream completions.
+type StreamingProvider interface {
+	Provider
+	ChatCompletionStream(ctx context.Context, req *models.ChatRequest, apiKey string, onChunk ChunkHandler) error
+}
+
+// SupportsStreaming reports whether a registered provider can stream completions
+func SupportsStreaming(name string) bool {
+	provider, err := GetProvider(name)
+	if err != nil {
+		return false
+	}
+	_, ok := unwrapProvider(provider).(StreamingProvider)
+	return ok
+}
+
+// DefaultRequestTimeout is the upstream request timeout used when none is configured
+const DefaultRequestTimeout = 30 * time.Second
+
+// withDefaultTimeout bounds ctx by timeout unless the caller already set a deadline
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
 var (
 	providersMu sync.RWMutex
 	providers   = make(map[string]Provider)
+	breakers    = make(map[string]*CircuitBreaker)
 )
 
-// RegisterProvider registers a new provider.
+// RegisterProvider registers a new provider, guarded by its own circuit breaker.
 func RegisterProvider(name string, provider Provider) {
 	providersMu.Lock()
 	defer providersMu.Unlock()
-	providers[name] = provider
+	breaker := NewCircuitBreaker(name, breakerSettings.failureThreshold, breakerSettings.cooldown)
+	providers[name] = &guardedProvider{Provider: provider, breaker: breaker}
+	breakers[name] = breaker
+}
+
+// UnregisterProvider removes a registered provider and its circuit breaker.
+func UnregisterProvider(name string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	delete(providers, name)
+	delete(breakers, name)
 }
 
 // GetProvider retrieves a registered provider by name.
@@ -37,11 +81,28 @@ func GetProvider(name string) (Provider, error) {
 	return p, nil
 }
 
+// GetBreakerStatuses returns the circuit breaker state of every registered provider.
+func GetBreakerStatuses() map[string]BreakerStatus {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	statuses := make(map[string]BreakerStatus, len(breakers))
+	for name, breaker := range breakers {
+		statuses[name] = breaker.Status()
+	}
+	return statuses
+}
+
 // InitProviders initializes and registers all available providers.
 func InitProviders(cfg *config.Config) {
+	configureBreakers(cfg)
+
 	RegisterProvider("gemini", NewGeminiProvider(cfg))
 	RegisterProvider("openrouter", NewOpenRouterProvider(cfg))
 	RegisterProvider("groq", NewGroqProvider(cfg))
 	RegisterProvider("atlas", NewAtlasProvider(cfg))
 	RegisterProvider("chutes", NewChutesProvider(cfg))
+
+	for _, custom := range cfg.CustomProviders {
+		RegisterProvider(custom.Name, NewCustomProvider(cfg, custom))
+	}
 }
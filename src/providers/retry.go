@@ -0,0 +1,167 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.app/src/config"
+)
+
+// RetryPolicy controls how failed upstream calls are retried
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts including the first one, 1 disables retries
+	BaseDelay   time.Duration // Backoff before the second attempt, doubled for every further attempt
+	MaxDelay    time.Duration // Upper bound for a single backoff; longer upstream hints stop retrying
+}
+
+// DefaultRetryPolicy is used for providers without retry configuration
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// newRetryPolicy builds the retry policy for a provider from configuration
+func newRetryPolicy(cfg *config.Config, provider string) RetryPolicy {
+	policy := DefaultRetryPolicy
+	retry := cfg.GetRetryConfig(provider)
+	if retry.MaxAttempts > 0 {
+		policy.MaxAttempts = retry.MaxAttempts
+	}
+	if retry.BaseDelayMs > 0 {
+		policy.BaseDelay = time.Duration(retry.BaseDelayMs) * time.Millisecond
+	}
+	if retry.MaxDelayMs > 0 {
+		policy.MaxDelay = time.Duration(retry.MaxDelayMs) * time.Millisecond
+	}
+	return policy
+}
+
+// backoff returns the jittered delay before the given retry (1 for the first retry)
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// Equal jitter: wait at least half the delay so retries stay spaced out
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + rand.N(half)
+}
+
+// IsRetryable reports whether a failed call may safely be repeated:
+// rate limiting, transient upstream errors and network failures are retryable,
+// anything that would fail the same way again is not
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable
+	}
+
+	var reqErr *RequestError
+	return errors.As(err, &reqErr)
+}
+
+// noRetryKey marks a context whose provider calls must not be retried
+type noRetryKey struct{}
+
+// withoutRetries returns a context under which every provider call is attempted only once
+func withoutRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+// withRetry calls fn until it succeeds, fails with a non-retryable error or the policy is exhausted
+func withRetry(ctx context.Context, provider string, policy RetryPolicy, fn func() error) error {
+	prefix := "[" + strings.ToUpper(provider) + "]"
+	if ctx.Value(noRetryKey{}) != nil {
+		policy.MaxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			// Waiting longer than the policy allows would only hold up the fallback chain
+			if apiErr.RetryAfter > policy.MaxDelay {
+				log.Printf("%s Upstream asked to retry after %v, giving up", prefix, apiErr.RetryAfter)
+				return err
+			}
+			delay = apiErr.RetryAfter
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		log.Printf("%s Attempt %d/%d failed, retrying in %v: %v", prefix, attempt, policy.MaxAttempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter returns how long upstream asked us to wait before retrying,
+// based on Retry-After or the x-ratelimit-reset-* headers, or 0 if it did not say
+func parseRetryAfter(header http.Header) time.Duration {
+	if delay := parseDelay(header.Get("Retry-After")); delay > 0 {
+		return delay
+	}
+
+	// Groq and OpenAI report separate request and token windows, wait for the later one
+	var delay time.Duration
+	for _, name := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens", "X-Ratelimit-Reset"} {
+		if d := parseDelay(header.Get(name)); d > delay {
+			delay = d
+		}
+	}
+	return delay
+}
+
+// parseDelay parses a delay given as seconds, a Go duration ("7.66s", "2m59s"),
+// a Unix timestamp in seconds or milliseconds, or an HTTP date
+func parseDelay(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		switch {
+		case seconds > 1e12: // Unix timestamp in milliseconds
+			return time.Until(time.UnixMilli(int64(seconds)))
+		case seconds > 1e9: // Unix timestamp in seconds
+			return time.Until(time.Unix(int64(seconds), 0))
+		default:
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
+}
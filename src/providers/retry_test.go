@@ -0,0 +1,127 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseDelay(t *testing.T) {
+	future := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"empty", "", 0, 0},
+		{"seconds", "30", 30 * time.Second, 30 * time.Second},
+		{"fractional seconds", "1.5", 1500 * time.Millisecond, 1500 * time.Millisecond},
+		{"go duration", "2m59s", 179 * time.Second, 179 * time.Second},
+		{"unix seconds", strconv.FormatInt(future.Unix(), 10), 58 * time.Second, time.Minute},
+		{"unix milliseconds", strconv.FormatInt(future.UnixMilli(), 10), 59 * time.Second, time.Minute},
+		{"http date", future.UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"garbage", "soon", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDelay(tt.value); got < tt.min || got > tt.max {
+				t.Fatalf("parseDelay(%q) = %v, want between %v and %v", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"none", http.Header{}, 0},
+		{"retry-after", http.Header{"Retry-After": {"5"}}, 5 * time.Second},
+		{"later reset wins", http.Header{"X-Ratelimit-Reset-Requests": {"2s"}, "X-Ratelimit-Reset-Tokens": {"7.5s"}}, 7500 * time.Millisecond},
+		{"retry-after first", http.Header{"Retry-After": {"1"}, "X-Ratelimit-Reset": {"10"}}, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRetryAfter(tt.header); got != tt.want {
+				t.Fatalf("parseRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		retry int
+		delay time.Duration // Unjittered delay, the backoff is between half of it and all of it
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{70, time.Second}, // The shift overflows
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.retry), func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := policy.backoff(tt.retry); got < tt.delay/2 || got >= tt.delay {
+					t.Fatalf("backoff(%d) = %v, want in [%v, %v)", tt.retry, got, tt.delay/2, tt.delay)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	transient := &APIError{StatusCode: http.StatusServiceUnavailable, Retryable: true}
+	rejected := &APIError{StatusCode: http.StatusBadRequest}
+	tooLong := &APIError{StatusCode: http.StatusTooManyRequests, Retryable: true, RetryAfter: time.Minute}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		errs      []error // Result of each call, nil once exhausted
+		wantCalls int
+		wantErr   error
+	}{
+		{"success", context.Background(), nil, 1, nil},
+		{"retried until success", context.Background(), []error{transient, transient}, 3, nil},
+		{"gives up after max attempts", context.Background(), []error{transient, transient, transient, transient}, 3, transient},
+		{"not retryable", context.Background(), []error{rejected}, 1, rejected},
+		{"retries disabled", withoutRetries(context.Background()), []error{transient}, 1, transient},
+		{"upstream asks to wait too long", context.Background(), []error{tooLong}, 1, tooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := withRetry(tt.ctx, "test", policy, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+				return nil
+			})
+
+			if calls != tt.wantCalls {
+				t.Errorf("%d calls, want %d", calls, tt.wantCalls)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
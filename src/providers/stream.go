@@ -0,0 +1,158 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"encore.app/src/models"
+)
+
+// streamDone is the sentinel payload OpenAI-compatible APIs send to end a stream
+const streamDone = "[DONE]"
+
+// streamClient is used for streaming requests. It has no overall timeout since
+// a stream may legitimately stay open for a long time, but still bounds the
+// wait for the upstream response headers. Streams end early when the request
+// context is cancelled, e.g. because the client disconnected.
+var streamClient = newStreamClient()
+
+func newStreamClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return &http.Client{Transport: transport}
+}
+
+// readSSE reads server-sent events from r and calls onData with the data of each event
+func readSSE(r io.Reader, onData func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	var data bytes.Buffer
+	dispatch := func() error {
+		if data.Len() == 0 {
+			return nil
+		}
+		payload := bytes.Clone(data.Bytes())
+		data.Reset()
+		return onData(payload)
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := dispatch(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Lines without a data field (comments, event names, ids) are ignored
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		if data.Len() > 0 {
+			data.WriteByte('\n')
+		}
+		data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %v", err)
+	}
+
+	return dispatch()
+}
+
+// openStream sends a streaming request and returns the response once upstream accepted it
+func openStream(provider string, httpReq *http.Request) (*http.Response, error) {
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := streamClient.Do(httpReq)
+	if err != nil {
+		return nil, newRequestError(provider, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(provider, resp, body)
+	}
+
+	return resp, nil
+}
+
+// streamOpenAICompatible streams a chat completion from an OpenAI-compatible endpoint.
+// The payload is sent with "stream": true and every upstream chunk is forwarded to onChunk.
+// Usage is requested for the final chunk so that streams can be metered.
+func streamOpenAICompatible(ctx context.Context, provider string, retry RetryPolicy, url string, headers map[string]string, payload map[string]interface{}, onChunk ChunkHandler) error {
+	payload["stream"] = true
+	payload["stream_options"] = map[string]interface{}{"include_usage": true}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	// Only opening the stream is retried, once chunks flow a failure is final
+	var resp *http.Response
+	err = withRetry(ctx, provider, retry, func() error {
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+
+		httpReq.Header.Set("Content-Type", "application/json")
+		for key, value := range headers {
+			httpReq.Header.Set(key, value)
+		}
+
+		resp, err = openStream(provider, httpReq)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	errDone := fmt.Errorf("stream done")
+	err = readSSE(resp.Body, func(data []byte) error {
+		if string(data) == streamDone {
+			return errDone
+		}
+
+		var chunk struct {
+			models.ChatCompletionChunk
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+			// Groq reports usage of the final chunk here instead
+			XGroq *struct {
+				Usage *models.Usage `json:"usage"`
+			} `json:"x_groq"`
+		}
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %v", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("API stream error: %s", chunk.Error.Message)
+		}
+
+		if chunk.Usage == nil && chunk.XGroq != nil {
+			chunk.Usage = chunk.XGroq.Usage
+		}
+		if chunk.Object == "" {
+			chunk.Object = "chat.completion.chunk"
+		}
+		return onChunk(&chunk.ChatCompletionChunk)
+	})
+	if err == errDone {
+		return nil
+	}
+	return err
+}
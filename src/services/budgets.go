@@ -0,0 +1,407 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/pubsub"
+	"encore.dev/storage/sqldb"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// DefaultBudgetWarnThreshold is the share of a budget that triggers a warning when none is configured
+const DefaultBudgetWarnThreshold = 0.8
+
+// Budget caps
+const (
+	BudgetTokens = "token"
+	BudgetCost   = "cost"
+)
+
+// BudgetExceededError is returned when a request would exceed the budget of its gateway key
+type BudgetExceededError struct {
+	Key      string
+	Period   string // models.BudgetPeriodDay or models.BudgetPeriodMonth
+	Limit    string // BudgetTokens or BudgetCost
+	ResetsAt time.Time
+}
+
+// Error implements the error interface
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("request would exceed the %s budget of key %s for this %s, resets at %s", e.Limit, e.Key, e.Period, e.ResetsAt.Format(time.RFC3339))
+}
+
+// BudgetService manages the budgets of gateway keys and enforces them with the usage ledger
+type BudgetService struct {
+	db       *sqldb.Database
+	config   *config.Config
+	warnings *pubsub.Topic[*models.BudgetWarning]
+	holds    budgetHolds
+}
+
+// NewBudgetService creates a new budget service reading spend from db and publishing warnings to warnings
+func NewBudgetService(db *sqldb.Database, cfg *config.Config, warnings *pubsub.Topic[*models.BudgetWarning]) *BudgetService {
+	return &BudgetService{
+		db:       db,
+		config:   cfg,
+		warnings: warnings,
+		holds:    budgetHolds{keys: make(map[int64]*budgetHold)},
+	}
+}
+
+// SetBudget replaces the budget of the key id. A warning already sent for the
+// current period is forgotten, so that a raised budget warns again.
+func (bs *BudgetService) SetBudget(ctx context.Context, id int64, req *models.Budget) (*models.APIKey, error) {
+	budget, err := validateBudget(req)
+	if err != nil {
+		return nil, err
+	}
+	budgetPeriod, tokenBudget, costBudget := budgetColumns(budget)
+
+	row := bs.db.QueryRow(ctx, `
+		UPDATE api_keys SET budget_period = $2, token_budget = $3, cost_budget_usd = $4
+		WHERE id = $1
+		RETURNING `+apiKeyColumns, id, budgetPeriod, tokenBudget, costBudget)
+	apiKey, err := scanAPIKey(row)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &errs.Error{Code: errs.NotFound, Message: fmt.Sprintf("API key %d not found", id)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update budget: %v", err)
+	}
+
+	if _, err := bs.db.Exec(ctx, `DELETE FROM budget_warnings WHERE api_key_id = $1`, id); err != nil {
+		log.Printf("[BUDGET] Failed to reset budget warnings of key %s: %v", apiKey.Name, err)
+	}
+	return apiKey, nil
+}
+
+// Status reports the spend of the key id in its current budget period, or in
+// the current month if it has no budget
+func (bs *BudgetService) Status(ctx context.Context, id int64) (*models.BudgetStatus, error) {
+	row := bs.db.QueryRow(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id)
+	apiKey, err := scanAPIKey(row)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &errs.Error{Code: errs.NotFound, Message: fmt.Sprintf("API key %d not found", id)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up key: %v", err)
+	}
+
+	period := models.BudgetPeriodMonth
+	if apiKey.Budget != nil {
+		period = apiKey.Budget.Period
+	}
+	start, end := budgetPeriod(period, time.Now())
+	tokens, cost, err := bs.spent(ctx, id, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.BudgetStatus{
+		APIKeyID:    id,
+		Budget:      apiKey.Budget,
+		PeriodStart: start,
+		ResetsAt:    end,
+		SpentTokens: tokens,
+		SpentUSD:    cost,
+	}, nil
+}
+
+// spent returns the tokens and cost the key id has used since start
+func (bs *BudgetService) spent(ctx context.Context, id int64, since time.Time) (int64, float64, error) {
+	var tokens int64
+	var cost float64
+	err := bs.db.QueryRow(ctx, `
+		SELECT COALESCE(SUM(prompt_tokens + completion_tokens), 0), COALESCE(SUM(cost_usd), 0)::float8
+		FROM usage_ledger
+		WHERE api_key_id = $1 AND created_at >= $2`, id, since).Scan(&tokens, &cost)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query spend: %v", err)
+	}
+	return tokens, cost, nil
+}
+
+// budgetHold is usage admitted against a budget that the usage ledger does not hold yet
+type budgetHold struct {
+	tokens int64
+	usd    float64
+}
+
+// budgetHolds tracks the usage held per gateway key by the requests in flight,
+// so that concurrent requests cannot exceed a budget together
+type budgetHolds struct {
+	mu   sync.Mutex
+	keys map[int64]*budgetHold
+}
+
+// add adds tokens and usd to the hold of the key id, dropping it once empty;
+// the caller holds the lock
+func (h *budgetHolds) add(id int64, tokens int64, usd float64) {
+	hold, ok := h.keys[id]
+	if !ok {
+		hold = &budgetHold{}
+		h.keys[id] = hold
+	}
+	hold.tokens += tokens
+	hold.usd += usd
+	// Float costs may not sum back to exactly zero
+	if hold.tokens <= 0 && hold.usd < 1e-9 {
+		delete(h.keys, id)
+	}
+}
+
+// budgetReservation records the usage one request holds against its key's budget
+type budgetReservation struct {
+	key     int64
+	held    budgetHold // Everything the request holds
+	attempt budgetHold // The estimate of the provider attempt in progress
+}
+
+// budgetReservationKey carries the budgetReservation of the current request
+type budgetReservationKey struct{}
+
+// Reserve returns a context in which the chat service holds the budget it
+// admits the request for, until Release once its usage is in the ledger.
+// Requests without a reservation are admitted against the holds of others only.
+func (bs *BudgetService) Reserve(ctx context.Context) context.Context {
+	key := apiKeyFrom(ctx)
+	if bs == nil || key == nil || key.Budget == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetReservationKey{}, &budgetReservation{key: key.ID})
+}
+
+// Release drops the budget held by the request of ctx
+func (bs *BudgetService) Release(ctx context.Context) {
+	reservation, ok := ctx.Value(budgetReservationKey{}).(*budgetReservation)
+	if !ok {
+		return
+	}
+
+	bs.holds.mu.Lock()
+	defer bs.holds.mu.Unlock()
+	bs.holds.add(reservation.key, -reservation.held.tokens, -reservation.held.usd)
+	reservation.held, reservation.attempt = budgetHold{}, budgetHold{}
+}
+
+// budgetCheck holds the spend of a gateway key in its current budget period,
+// to admit the provider attempts of one request
+type budgetCheck struct {
+	key         *models.APIKey
+	start       time.Time
+	resetsAt    time.Time
+	spentTokens int64
+	spentUSD    float64
+	holds       *budgetHolds       // Usage held by the requests in flight, nil to ignore them
+	reservation *budgetReservation // Usage held by this request, nil if it holds none
+}
+
+// check loads the spend of the caller's gateway key, publishing a warning when
+// it has reached the warning threshold. Returns nil if the key has no budget.
+func (bs *BudgetService) check(ctx context.Context) (*budgetCheck, error) {
+	key := apiKeyFrom(ctx)
+	if key == nil || key.Budget == nil {
+		return nil, nil
+	}
+
+	start, end := budgetPeriod(key.Budget.Period, time.Now())
+	tokens, cost, err := bs.spent(ctx, key.ID, start)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &budgetCheck{key: key, start: start, resetsAt: end, spentTokens: tokens, spentUSD: cost, holds: &bs.holds}
+	check.reservation, _ = ctx.Value(budgetReservationKey{}).(*budgetReservation)
+	if threshold := bs.warnThreshold(); check.reached(threshold) {
+		bs.warn(ctx, check, threshold)
+	}
+	return check, nil
+}
+
+// warnThreshold returns the configured warning threshold or its default
+func (bs *BudgetService) warnThreshold() float64 {
+	if bs.config.Budgets.WarnThreshold > 0 {
+		return bs.config.Budgets.WarnThreshold
+	}
+	return DefaultBudgetWarnThreshold
+}
+
+// warn publishes a BudgetWarning for the period of check, unless one was already published
+func (bs *BudgetService) warn(ctx context.Context, check *budgetCheck, threshold float64) {
+	result, err := bs.db.Exec(ctx, `
+		INSERT INTO budget_warnings (api_key_id, period_start) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`, check.key.ID, check.start)
+	if err != nil {
+		log.Printf("[BUDGET] Failed to record budget warning of key %s: %v", check.key.Name, err)
+		return
+	}
+	if result.RowsAffected() == 0 {
+		return
+	}
+
+	log.Printf("[BUDGET] Key %s has used %.0f%% of its %s budget: %d tokens, $%.4f", check.key.Name, threshold*100, check.key.Budget.Period, check.spentTokens, check.spentUSD)
+	warning := &models.BudgetWarning{
+		APIKeyID:    check.key.ID,
+		APIKeyName:  check.key.Name,
+		Budget:      *check.key.Budget,
+		PeriodStart: check.start,
+		SpentTokens: check.spentTokens,
+		SpentUSD:    check.spentUSD,
+		Threshold:   threshold,
+	}
+	if _, err := bs.warnings.Publish(ctx, warning); err != nil {
+		log.Printf("[BUDGET] Failed to publish budget warning of key %s: %v", check.key.Name, err)
+	}
+}
+
+// reached reports whether the spend has reached share of either cap
+func (c *budgetCheck) reached(share float64) bool {
+	budget := c.key.Budget
+	return (budget.Tokens != nil && float64(c.spentTokens) >= share*float64(*budget.Tokens)) ||
+		(budget.CostUSD != nil && c.spentUSD >= share*(*budget.CostUSD))
+}
+
+// admit checks that a request estimated at tokens fits the rest of the budget,
+// counting the usage other requests in flight hold, and holds the estimate until
+// settle or release. Its cost is bounded by the higher of the two prices; with
+// an unknown price only an exhausted cost budget rejects it.
+func (c *budgetCheck) admit(tokens int, price *providers.Pricing) error {
+	if c == nil {
+		return nil
+	}
+
+	cost := 0.0
+	if price != nil {
+		cost = float64(tokens) * max(price.Input, price.Output) / 1e6
+	}
+	if c.holds == nil {
+		return c.fits(int64(tokens), cost, budgetHold{})
+	}
+
+	c.holds.mu.Lock()
+	defer c.holds.mu.Unlock()
+	var held budgetHold
+	if hold, ok := c.holds.keys[c.key.ID]; ok {
+		held = *hold
+	}
+	if err := c.fits(int64(tokens), cost, held); err != nil {
+		return err
+	}
+	if c.reservation != nil {
+		c.reservation.attempt = budgetHold{tokens: int64(tokens), usd: cost}
+		c.hold(c.reservation.attempt)
+	}
+	return nil
+}
+
+// fits returns a BudgetExceededError unless tokens costing cost fit the budget
+// on top of the spend and the held usage
+func (c *budgetCheck) fits(tokens int64, cost float64, held budgetHold) error {
+	budget := c.key.Budget
+	if budget.Tokens != nil && c.spentTokens+held.tokens+tokens > *budget.Tokens {
+		return &BudgetExceededError{Key: c.key.Name, Period: budget.Period, Limit: BudgetTokens, ResetsAt: c.resetsAt}
+	}
+	if budget.CostUSD != nil {
+		spent := c.spentUSD + held.usd
+		if spent+cost > *budget.CostUSD || spent >= *budget.CostUSD {
+			return &BudgetExceededError{Key: c.key.Name, Period: budget.Period, Limit: BudgetCost, ResetsAt: c.resetsAt}
+		}
+	}
+	return nil
+}
+
+// settle replaces the estimate held for the last admitted attempt with usage at
+// price, which the request holds until the ledger records it. A nil usage keeps
+// the estimate, which the ledger records in its place.
+func (c *budgetCheck) settle(usage *models.Usage, price *providers.Pricing) {
+	if c == nil || c.holds == nil || c.reservation == nil || usage == nil {
+		return
+	}
+
+	used := budgetHold{tokens: int64(usage.PromptTokens + usage.CompletionTokens)}
+	if price != nil {
+		used.usd = usageCost(usage, price)
+	}
+
+	c.holds.mu.Lock()
+	defer c.holds.mu.Unlock()
+	c.hold(budgetHold{tokens: used.tokens - c.reservation.attempt.tokens, usd: used.usd - c.reservation.attempt.usd})
+	c.reservation.attempt = budgetHold{}
+}
+
+// release drops the estimate held for the last admitted attempt, whose usage
+// the ledger already holds or which used nothing
+func (c *budgetCheck) release() {
+	c.settle(&models.Usage{}, nil)
+}
+
+// hold adds usage to what the request holds; the caller holds the lock
+func (c *budgetCheck) hold(usage budgetHold) {
+	c.holds.add(c.reservation.key, usage.tokens, usage.usd)
+	c.reservation.held.tokens += usage.tokens
+	c.reservation.held.usd += usage.usd
+}
+
+// exhausted returns a BudgetExceededError if a cap of the budget is used up,
+// which refuses even requests served without calling a provider
+func (c *budgetCheck) exhausted() error {
+	if c == nil {
+		return nil
+	}
+
+	budget := c.key.Budget
+	if budget.Tokens != nil && c.spentTokens >= *budget.Tokens {
+		return &BudgetExceededError{Key: c.key.Name, Period: budget.Period, Limit: BudgetTokens, ResetsAt: c.resetsAt}
+	}
+	if budget.CostUSD != nil && c.spentUSD >= *budget.CostUSD {
+		return &BudgetExceededError{Key: c.key.Name, Period: budget.Period, Limit: BudgetCost, ResetsAt: c.resetsAt}
+	}
+	return nil
+}
+
+// budgetPeriod returns the start and end of the UTC calendar day or month containing now
+func budgetPeriod(period string, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	if period == models.BudgetPeriodDay {
+		start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 0, 1)
+	}
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// validateBudget checks a requested budget, returning nil for one without caps
+func validateBudget(budget *models.Budget) (*models.Budget, error) {
+	if budget == nil || (budget.Tokens == nil && budget.CostUSD == nil) {
+		return nil, nil
+	}
+	if budget.Period != models.BudgetPeriodDay && budget.Period != models.BudgetPeriodMonth {
+		return nil, invalidRequest("unknown budget period %q, expected %s or %s", budget.Period, models.BudgetPeriodDay, models.BudgetPeriodMonth)
+	}
+	if (budget.Tokens != nil && *budget.Tokens < 0) || (budget.CostUSD != nil && *budget.CostUSD < 0) {
+		return nil, invalidRequest("budgets must not be negative")
+	}
+	return budget, nil
+}
+
+// budgetColumns returns the api_keys column values of a budget, all NULL for none
+func budgetColumns(budget *models.Budget) (*string, *int64, *float64) {
+	if budget == nil {
+		return nil, nil, nil
+	}
+	return &budget.Period, budget.Tokens, budget.CostUSD
+}
+
+// attemptPrice returns the price of the model an attempt will use, nil if unknown
+func (cs *ChatService) attemptPrice(attempt providerAttempt) *providers.Pricing {
+	return cs.prices.Price(attempt.provider.GetName(), attempt.targetModel())
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+func TestBudgetCheck(t *testing.T) {
+	tokens, cost := int64(1000), 1.0
+	price := &providers.Pricing{Input: 100, Output: 200}
+
+	tests := []struct {
+		name          string
+		budget        models.Budget
+		spentTokens   int64
+		spentUSD      float64
+		estimate      int
+		wantAdmit     string // Limit of the error admitting estimate, "" if admitted
+		wantExhausted string // Limit of the error for a response served without a provider, "" if served
+	}{
+		{"within budget", models.Budget{Tokens: &tokens, CostUSD: &cost}, 100, 0.1, 100, "", ""},
+		{"estimate exceeds tokens", models.Budget{Tokens: &tokens}, 900, 0, 200, BudgetTokens, ""},
+		{"tokens used up", models.Budget{Tokens: &tokens}, 1000, 0, 1, BudgetTokens, BudgetTokens},
+		{"estimate exceeds cost", models.Budget{CostUSD: &cost}, 0, 0.5, 5000, BudgetCost, ""},
+		{"cost used up", models.Budget{CostUSD: &cost}, 0, 1, 0, BudgetCost, BudgetCost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &budgetCheck{
+				key:         &models.APIKey{Name: "k", Budget: &tt.budget},
+				spentTokens: tt.spentTokens,
+				spentUSD:    tt.spentUSD,
+			}
+			if got := budgetLimit(check.admit(tt.estimate, price)); got != tt.wantAdmit {
+				t.Errorf("admit(%d) exceeded %q, want %q", tt.estimate, got, tt.wantAdmit)
+			}
+			if got := budgetLimit(check.exhausted()); got != tt.wantExhausted {
+				t.Errorf("exhausted() exceeded %q, want %q", got, tt.wantExhausted)
+			}
+		})
+	}
+
+	// A key without a budget is never refused
+	var none *budgetCheck
+	if err := none.admit(1<<30, price); err != nil {
+		t.Errorf("admit without a budget: %v", err)
+	}
+	if err := none.exhausted(); err != nil {
+		t.Errorf("exhausted without a budget: %v", err)
+	}
+}
+
+func TestBudgetHolds(t *testing.T) {
+	tokens, cost := int64(1000), 1.0
+	price := &providers.Pricing{Input: 100, Output: 200}
+	key := &models.APIKey{ID: 1, Name: "k", Budget: &models.Budget{Period: models.BudgetPeriodDay, Tokens: &tokens, CostUSD: &cost}}
+	bs := NewBudgetService(nil, &config.Config{}, nil)
+
+	// request returns the budget check of a new request of key, spent the ledger's spend
+	request := func(spent int64) (context.Context, *budgetCheck) {
+		ctx := bs.Reserve(WithAPIKey(context.Background(), key))
+		reservation, _ := ctx.Value(budgetReservationKey{}).(*budgetReservation)
+		return ctx, &budgetCheck{key: key, spentTokens: spent, holds: &bs.holds, reservation: reservation}
+	}
+
+	// Concurrent requests are admitted only as far as their estimates fit together
+	var admitted sync.WaitGroup
+	var mu sync.Mutex
+	var contexts []context.Context
+	for i := 0; i < 10; i++ {
+		admitted.Add(1)
+		go func() {
+			defer admitted.Done()
+			ctx, check := request(0)
+			if check.admit(200, nil) == nil {
+				mu.Lock()
+				contexts = append(contexts, ctx)
+				mu.Unlock()
+			}
+		}()
+	}
+	admitted.Wait()
+	if len(contexts) != 5 {
+		t.Fatalf("admitted %d requests of 200 tokens, want 5 within 1000", len(contexts))
+	}
+	for _, ctx := range contexts {
+		bs.Release(ctx)
+	}
+	if len(bs.holds.keys) != 0 {
+		t.Fatalf("holds %+v left after every request released", bs.holds.keys)
+	}
+
+	// A settled attempt holds its usage instead of its estimate until released
+	ctx, first := request(0)
+	if err := first.admit(600, price); err != nil {
+		t.Fatalf("admit failed: %v", err)
+	}
+	_, second := request(0)
+	if err := second.admit(600, price); budgetLimit(err) != BudgetTokens {
+		t.Fatalf("admitted beside a held estimate: %v", err)
+	}
+	first.settle(&models.Usage{PromptTokens: 100, CompletionTokens: 100, TotalTokens: 200}, price)
+	if err := second.admit(600, price); err != nil {
+		t.Fatalf("not admitted beside a settled attempt: %v", err)
+	}
+	if err := second.admit(300, price); budgetLimit(err) != BudgetTokens {
+		t.Fatalf("admitted beyond a settled attempt: %v", err)
+	}
+	second.release()
+	bs.Release(ctx)
+	if len(bs.holds.keys) != 0 {
+		t.Fatalf("holds %+v left after every request released", bs.holds.keys)
+	}
+
+	// The spend recorded in the ledger counts alongside the holds
+	_, check := request(900)
+	if err := check.admit(200, nil); budgetLimit(err) != BudgetTokens {
+		t.Fatalf("admitted beyond the ledger's spend: %v", err)
+	}
+}
+
+// budgetLimit returns the limit a BudgetExceededError reports, "" for nil
+func budgetLimit(err error) string {
+	var budgetErr *BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		return budgetErr.Limit
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
@@ -1,7 +1,8 @@
 package services
 
 import (
-	"fmt"
+	"context"
+	"log"
 	"time"
 
 	"encore.app/src/config"
@@ -14,22 +15,42 @@ const (
 	DefaultProvider       = "groq"
 	DefaultTemperature    = 0.5
 	DefaultMaxTokens      = 1000
+	MaxRequestTimeout     = 300 // seconds
 	StatusHealthy         = "healthy"
 	StatusNoAPIKeys       = "no_api_keys"
 	StatusInvalidRequest  = "invalid_request"
 	StatusInvalidProvider = "invalid_provider"
+	StatusUnavailable     = "unavailable"
+	StatusUnhealthy       = "unhealthy"
 )
 
 // ChatService handles chat completion business logic
 type ChatService struct {
-	config *config.Config
+	config   *config.Config
+	models   *modelCache
+	prices   *ModelPrices
+	limiter  *RateLimiter
+	budgets  *BudgetService
+	cache    *ResponseCache
+	semantic *SemanticCache
+	usage    *UsageLedger
 }
 
-// NewChatService creates a new chat service instance
-func NewChatService(cfg *config.Config) *ChatService {
+// NewChatService creates a new chat service instance pricing models with prices,
+// enforcing the key budgets of budgets, serving repeated requests from
+// responseCache, if not nil, and metering the calls it makes on its own, like
+// semantic cache lookups, into usage
+func NewChatService(cfg *config.Config, prices *ModelPrices, budgets *BudgetService, responseCache *ResponseCache, usage *UsageLedger) *ChatService {
 	providers.InitProviders(cfg)
 	return &ChatService{
-		config: cfg,
+		config:   cfg,
+		models:   prices.models,
+		prices:   prices,
+		limiter:  NewRateLimiter(),
+		budgets:  budgets,
+		cache:    responseCache,
+		semantic: newSemanticCache(cfg),
+		usage:    usage,
 	}
 }
 
@@ -45,40 +66,242 @@ func setDefaults(req *models.ChatRequest) {
 	}
 }
 
-// getProviderName returns the provider name with default fallback
-func getProviderName(providerName string) string {
-	if providerName == "" {
-		return DefaultProvider
+// withRequestTimeout applies the caller's timeout override to ctx, if any
+func withRequestTimeout(ctx context.Context, req *models.ChatRequest) (context.Context, context.CancelFunc, error) {
+	if req.Timeout == nil {
+		return ctx, func() {}, nil
 	}
-	return providerName
+	if *req.Timeout <= 0 || *req.Timeout > MaxRequestTimeout {
+		return nil, nil, invalidRequest("timeout must be between 1 and %d seconds", MaxRequestTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(*req.Timeout)*time.Second)
+	return ctx, cancel, nil
 }
 
-// ProcessChatCompletion processes a chat completion request
-func (cs *ChatService) ProcessChatCompletion(req *models.ChatRequest) (*models.ChatResponse, error) {
+// prepareRequest validates the request, applies defaults and resolves the provider chain
+// the caller's gateway key permits
+func (cs *ChatService) prepareRequest(ctx context.Context, req *models.ChatRequest) ([]providerAttempt, error) {
+	// A legacy prompt becomes the only user message
+	if len(req.Messages) == 0 && req.Prompt != "" {
+		req.Messages = []models.ChatMessage{
+			{
+				Role:    "user",
+				Content: []models.ContentPart{{Type: "text", Text: req.Prompt}},
+			},
+		}
+	}
 	if len(req.Messages) == 0 {
-		return nil, fmt.Errorf("invalid request: messages cannot be empty")
+		return nil, invalidRequest("messages or prompt is required")
+	}
+	switch req.ContentFormat {
+	case "", models.ContentFormatString, models.ContentFormatParts:
+	default:
+		return nil, invalidRequest("unknown content_format %q", req.ContentFormat)
+	}
+	switch req.Cache {
+	case "", models.CacheNoStore, models.CacheSemantic:
+	default:
+		return nil, invalidRequest("unknown cache mode %q, expected %s or %s", req.Cache, models.CacheNoStore, models.CacheSemantic)
+	}
+	if err := validateResponseFormatRequest(req.ResponseFormat); err != nil {
+		return nil, err
 	}
 
 	// Apply default values
 	setDefaults(req)
 
-	// Get provider name with default
-	providerName := getProviderName(req.Provider)
+	attempts, err := cs.resolveAttempts(req)
+	if err != nil {
+		return nil, err
+	}
+	return cs.permitAttempts(ctx, req.Model, attempts, providers.DefaultModel)
+}
+
+// ProcessChatCompletion processes a chat completion request, falling back
+// through the provider chain when a provider is unavailable
+func (cs *ChatService) ProcessChatCompletion(ctx context.Context, req *models.ChatRequest) (*models.ChatResponse, error) {
+	// Refund the key's rate limit charge unless the request settles it
+	defer cs.settleKey(ctx, 0)
 
-	// Get API key
-	apiKey := cs.config.GetAPIKey(providerName)
-	if apiKey == "" {
-		return nil, fmt.Errorf("API key not found for provider: %s", providerName)
+	attempts, err := cs.prepareRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := withRequestTimeout(ctx, req)
+	if err != nil {
+		return nil, err
 	}
+	defer cancel()
 
-	// Get provider instance
-	provider, err := providers.GetProvider(providerName)
+	// Cache hits are free, but a key whose budget is used up is not served at all
+	budget, err := cs.budgets.check(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if err := budget.exhausted(); err != nil {
+		return nil, err
+	}
+
+	cacheKey, cacheable := cs.cache.key(ctx, req, attempts)
+	if cacheable {
+		if response := cs.cache.get(ctx, cacheKey); response != nil {
+			response.CacheStatus = models.CacheHit
+			response.Cache = &models.CacheInfo{Type: models.CacheTypeExact}
+			response.SetStringContent(req.WantsStringContent())
+			return response, nil
+		}
+	}
+
+	query := cs.semanticQuery(ctx, req, attempts)
+	if query != nil {
+		if response, similarity := cs.semantic.find(query); response != nil {
+			response.CacheStatus = models.CacheHit
+			response.Cache = &models.CacheInfo{Type: models.CacheTypeSemantic, Similarity: &similarity}
+			response.SetStringContent(req.WantsStringContent())
+			return response, nil
+		}
+
+		// Reload the spend, which now includes the lookup's embedding
+		if budget, err = cs.budgets.check(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	estimate := estimateRequestTokens(req)
+	spent := 0 // Tokens of failed attempts the providers billed
+	var lastErr error
+	for i, attempt := range attempts {
+		name := attempt.provider.GetName()
+		if err := budget.admit(estimate, cs.attemptPrice(attempt)); err != nil {
+			lastErr = err
+			log.Printf("[CHAT] Skipping provider %s: %v", name, err)
+			continue
+		}
+		if err := cs.admitProvider(name, estimate); err != nil {
+			budget.release()
+			lastErr = err
+			log.Printf("[CHAT] Skipping provider %s: %v", name, err)
+			continue
+		}
+
+		// Call the provider, validating structured output
+		response, usage, err := cs.callProvider(ctx, attempt, req)
+		if err == nil {
+			budget.settle(&response.Usage, cs.attemptPrice(attempt))
+			used := usedTokens(&response.Usage, estimate)
+			cs.settleProvider(name, estimate, used)
+			cs.settleKey(ctx, spent+used)
+			response.Provider = name
+			response.PricedModel = attempt.targetModel()
+			response.SetStringContent(req.WantsStringContent())
+			if cacheable {
+				response.CacheStatus = models.CacheMiss
+				cs.cache.set(ctx, cacheKey, response)
+			}
+			if query != nil {
+				response.CacheStatus = models.CacheMiss
+				cs.semantic.add(query, response)
+			}
+			return response, nil
+		}
+
+		// Responses discarded for invalid output were still billed
+		cs.settleProvider(name, estimate, usage.TotalTokens)
+		cs.usage.recordDiscarded(ctx, name, attempt.targetModel(), &usage)
+		budget.release()
+		spent += usage.TotalTokens
+
+		lastErr = err
+		if i == len(attempts)-1 || !shouldFallback(ctx, err) {
+			break
+		}
+		log.Printf("[CHAT] Provider %s failed, falling back to %s: %v", name, attempts[i+1].provider.GetName(), err)
+	}
+
+	cs.settleKey(ctx, spent)
+	return nil, lastErr
+}
+
+// ProcessChatCompletionStream processes a streaming chat completion request,
+// calling onChunk for every chunk received from the provider. The next provider
+// in the chain is only tried if the failing one has not sent any chunk yet.
+func (cs *ChatService) ProcessChatCompletionStream(ctx context.Context, req *models.ChatRequest, onChunk providers.ChunkHandler) error {
+	// Refund the key's rate limit charge unless the request settles it
+	defer cs.settleKey(ctx, 0)
+
+	attempts, err := cs.prepareRequest(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel, err := withRequestTimeout(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	budget, err := cs.budgets.check(ctx)
+	if err != nil {
+		return err
+	}
+
+	estimate := estimateRequestTokens(req)
+	var lastErr error
+	for i, attempt := range attempts {
+		name := attempt.provider.GetName()
+		if !providers.SupportsStreaming(name) {
+			lastErr = invalidRequest("provider %s does not support streaming", name)
+			continue
+		}
+		if err := budget.admit(estimate, cs.attemptPrice(attempt)); err != nil {
+			lastErr = err
+			log.Printf("[CHAT] Skipping provider %s: %v", name, err)
+			continue
+		}
+		if err := cs.admitProvider(name, estimate); err != nil {
+			budget.release()
+			lastErr = err
+			log.Printf("[CHAT] Skipping provider %s: %v", name, err)
+			continue
+		}
+
+		started := false
+		var usage *models.Usage
+		validator := newOutputValidator(name, req.ResponseFormat)
+		// Registered providers are guarded, which streams; SupportsStreaming checked the provider behind it
+		err := attempt.provider.(providers.StreamingProvider).ChatCompletionStream(ctx, attempt.request(req), attempt.apiKey, validator.wrap(func(chunk *models.ChatCompletionChunk) error {
+			started = true
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			chunk.Provider = name
+			chunk.PricedModel = attempt.targetModel()
+			return onChunk(chunk)
+		}))
+		if err == nil || started {
+			// Whatever was streamed has been generated, even if the stream failed later
+			budget.settle(usage, cs.attemptPrice(attempt))
+			used := usedTokens(usage, estimate)
+			cs.settleProvider(name, estimate, used)
+			cs.settleKey(ctx, used)
+			if err == nil {
+				return nil
+			}
+			return err
+		}
+
+		cs.settleProvider(name, estimate, 0)
+		budget.release()
+		lastErr = err
+		if i == len(attempts)-1 || !shouldFallback(ctx, err) {
+			break
+		}
+		log.Printf("[CHAT] Provider %s failed, falling back to %s: %v", name, attempts[i+1].provider.GetName(), err)
+	}
 
-	// Call the provider
-	return provider.ChatCompletion(req, apiKey)
+	return lastErr
 }
 
 // GetHealthStatus returns the health status of the service
@@ -88,7 +311,7 @@ func (cs *ChatService) GetHealthStatus() *models.HealthResponse {
 	hasAnyKey := false
 
 	for _, provider := range cs.config.GetSupportedProviders() {
-		if cs.config.GetAPIKey(provider) != "" {
+		if cs.config.IsConfigured(provider) {
 			hasAnyKey = true
 			break
 		}
@@ -98,12 +321,40 @@ func (cs *ChatService) GetHealthStatus() *models.HealthResponse {
 		chatStatus = StatusNoAPIKeys
 	}
 
+	services := map[string]string{
+		"chat": chatStatus,
+	}
+
+	// Report the circuit breaker of every provider, the chat service is
+	// unavailable when every configured provider's breaker is open
+	providerHealth := make(map[string]models.ProviderHealth)
+	allOpen := hasAnyKey
+	for name, status := range providers.GetBreakerStatuses() {
+		health := models.ProviderHealth{
+			State:        string(status.State),
+			FailureCount: status.FailureCount,
+			LastFailure:  status.LastFailure,
+		}
+		if !status.LastErrorAt.IsZero() {
+			health.LastErrorAt = status.LastErrorAt.Format(time.RFC3339)
+		}
+		providerHealth[name] = health
+		services["provider:"+name] = health.State
+
+		if cs.config.IsConfigured(name) && status.State != providers.BreakerOpen {
+			allOpen = false
+		}
+	}
+
+	if allOpen {
+		services["chat"] = StatusUnavailable
+	}
+
 	return &models.HealthResponse{
 		Status:    StatusHealthy,
 		Timestamp: time.Now().Format(time.RFC3339),
-		Services: map[string]string{
-			"chat": chatStatus,
-		},
+		Services:  services,
+		Providers: providerHealth,
 	}
 }
 
@@ -114,8 +365,8 @@ func (cs *ChatService) GetSupportedProviders() *models.ProvidersResponse {
 	}
 }
 
-// TestProvider tests if a specific provider is working
-func (cs *ChatService) TestProvider(req *models.TestProviderRequest) *models.TestProviderResponse {
+// TestProvider tests if a specific provider is working by sending it a tiny completion
+func (cs *ChatService) TestProvider(ctx context.Context, req *models.TestProviderRequest) *models.TestProviderResponse {
 	if req.Provider == "" {
 		return &models.TestProviderResponse{
 			Provider: req.Provider,
@@ -132,16 +383,26 @@ func (cs *ChatService) TestProvider(req *models.TestProviderRequest) *models.Tes
 	}
 
 	// Check if API key is available
-	apiKey := cs.config.GetAPIKey(req.Provider)
-	if apiKey == "" {
+	if !cs.config.IsConfigured(req.Provider) {
 		return &models.TestProviderResponse{
 			Provider: req.Provider,
 			Status:   StatusNoAPIKeys,
 		}
 	}
 
-	return &models.TestProviderResponse{
-		Provider: req.Provider,
-		Status:   StatusHealthy,
+	result := providers.Probe(ctx, req.Provider, req.Model, cs.config.GetAPIKey(req.Provider))
+	response := &models.TestProviderResponse{
+		Provider:   req.Provider,
+		Status:     StatusHealthy,
+		Model:      result.Model,
+		LatencyMs:  result.Latency.Milliseconds(),
+		HTTPStatus: result.StatusCode,
+	}
+	if result.Err != nil {
+		log.Printf("[CHAT] Probe of provider %s failed (%s): %v", req.Provider, result.Reason, result.Err)
+		response.Status = StatusUnhealthy
+		response.Reason = result.Reason
+		response.Error = result.Err.Error()
 	}
+	return response
 }
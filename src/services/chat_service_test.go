@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+func TestStreamRejectsProviderThatCannotStream(t *testing.T) {
+	provider := &fakeProvider{name: "plain", defaultModel: "model-1"}
+	registerProvider(t, "plain", provider)
+
+	cfg := &config.Config{CustomProviders: []config.CustomProvider{{Name: "plain", AuthScheme: config.AuthSchemeNone}}}
+	cs := &ChatService{config: cfg, prices: NewModelPrices(cfg), limiter: NewRateLimiter()}
+
+	stream := true
+	req := &models.ChatRequest{Prompt: "hi", Provider: models.ProviderList{"plain"}, Stream: &stream}
+	err := cs.ProcessChatCompletionStream(context.Background(), req, func(chunk *models.ChatCompletionChunk) error {
+		t.Fatalf("unexpected chunk from a provider that cannot stream")
+		return nil
+	})
+
+	var apiErr *errs.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != errs.InvalidArgument {
+		t.Fatalf("got %v, want an invalid argument error", err)
+	}
+}
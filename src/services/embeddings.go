@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"log"
+	"math"
+
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// MaxEmbeddingInputs bounds the number of texts in one embeddings request
+const MaxEmbeddingInputs = 2048
+
+// ProcessEmbeddings embeds the request inputs. Vectors of different models are not
+// comparable, so only a provider list given on the request is fallen back through;
+// otherwise the routed provider, or the first one able to embed, is the only one tried.
+func (cs *ChatService) ProcessEmbeddings(ctx context.Context, req *models.EmbeddingRequest) (*models.EmbeddingResponse, error) {
+	// Refund the key's rate limit charge unless the request settles it
+	defer cs.settleKey(ctx, 0)
+
+	if len(req.Input) == 0 {
+		return nil, invalidRequest("input cannot be empty")
+	}
+	if len(req.Input) > MaxEmbeddingInputs {
+		return nil, invalidRequest("at most %d inputs are allowed", MaxEmbeddingInputs)
+	}
+	switch req.EncodingFormat {
+	case "", models.EncodingFormatFloat, models.EncodingFormatBase64:
+	default:
+		return nil, invalidRequest("unknown encoding_format %q", req.EncodingFormat)
+	}
+
+	attempts, err := cs.embeddingAttempts(req)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err = cs.permitAttempts(ctx, req.Model, attempts, embeddingModel)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Provider) == 0 {
+		attempts = attempts[:1]
+	}
+
+	response, err := cs.embed(ctx, req, attempts)
+	if err != nil {
+		return nil, err
+	}
+	cs.settleKey(ctx, embeddingTokens(response, estimateEmbeddingTokens(req)))
+	return response, nil
+}
+
+// embeddingAttempts resolves the provider chain of an embeddings request,
+// rejecting it if a provider of the chain cannot embed
+func (cs *ChatService) embeddingAttempts(req *models.EmbeddingRequest) ([]providerAttempt, error) {
+	routeReq := &models.ChatRequest{Model: req.Model, Provider: req.Provider}
+	if req.Model == "" && len(req.Provider) == 0 {
+		name, err := cs.defaultEmbeddingProvider()
+		if err != nil {
+			return nil, err
+		}
+		routeReq.Provider = models.ProviderList{name}
+	}
+
+	attempts, err := cs.resolveAttempts(routeReq)
+	if err != nil {
+		return nil, err
+	}
+	for _, attempt := range attempts {
+		if name := attempt.provider.GetName(); !providers.SupportsEmbeddings(name) {
+			return nil, invalidRequest("provider %s does not support embeddings", name)
+		}
+	}
+	return attempts, nil
+}
+
+// embed embeds the request inputs with the first attempt that succeeds, within
+// the budget of the caller's gateway key
+func (cs *ChatService) embed(ctx context.Context, req *models.EmbeddingRequest, attempts []providerAttempt) (*models.EmbeddingResponse, error) {
+	budget, err := cs.budgets.check(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := estimateEmbeddingTokens(req)
+	var lastErr error
+	for i, attempt := range attempts {
+		name := attempt.provider.GetName()
+		if err := budget.admit(estimate, cs.embeddingPrice(attempt)); err != nil {
+			lastErr = err
+			log.Printf("[CHAT] Skipping provider %s: %v", name, err)
+			continue
+		}
+		if err := cs.admitProvider(name, estimate); err != nil {
+			budget.release()
+			lastErr = err
+			log.Printf("[CHAT] Skipping provider %s: %v", name, err)
+			continue
+		}
+
+		attemptReq := *req
+		attemptReq.Model = attempt.model
+		// Registered providers are guarded, which embeds; embeddingAttempts checked the provider behind it
+		result, err := attempt.provider.(providers.EmbeddingProvider).Embeddings(ctx, &attemptReq, attempt.apiKey)
+		if err == nil {
+			response := newEmbeddingResponse(result, name, req.EncodingFormat)
+			response.PricedModel = embeddingTarget(attempt)
+			cs.settleProvider(name, estimate, embeddingTokens(response, estimate))
+			if response.Usage.PromptTokens > 0 {
+				budget.settle(&models.Usage{PromptTokens: response.Usage.PromptTokens, TotalTokens: response.Usage.TotalTokens}, cs.embeddingPrice(attempt))
+			}
+			return response, nil
+		}
+
+		cs.settleProvider(name, estimate, 0)
+		budget.release()
+		lastErr = err
+		if i == len(attempts)-1 || !shouldFallback(ctx, err) {
+			break
+		}
+		log.Printf("[CHAT] Provider %s failed, falling back to %s: %v", name, attempts[i+1].provider.GetName(), err)
+	}
+
+	return nil, lastErr
+}
+
+// embeddingTokens returns the tokens reported for an embeddings response, or the estimate if none were
+func embeddingTokens(response *models.EmbeddingResponse, estimate int) int {
+	if response.Usage.TotalTokens == 0 {
+		return estimate
+	}
+	return response.Usage.TotalTokens
+}
+
+// defaultEmbeddingProvider returns the first configured provider that can embed,
+// preferring the configured fallback chain
+func (cs *ChatService) defaultEmbeddingProvider() (string, error) {
+	names := append([]string{}, cs.config.Fallback.Providers...)
+	names = append(names, cs.config.GetSupportedProviders()...)
+
+	for _, name := range names {
+		if cs.config.IsConfigured(name) && providers.SupportsEmbeddings(name) {
+			return name, nil
+		}
+	}
+	return "", unavailable("no configured provider supports embeddings")
+}
+
+// embeddingModel returns the model a provider embeds with when the request names none
+func embeddingModel(provider providers.Provider) string {
+	if embedder, ok := provider.(providers.EmbeddingProvider); ok {
+		return embedder.EmbeddingModel()
+	}
+	return ""
+}
+
+// embeddingTarget returns the model an embedding attempt requests, the provider default if it names none
+func embeddingTarget(attempt providerAttempt) string {
+	if attempt.model == "" {
+		return embeddingModel(attempt.provider)
+	}
+	return attempt.model
+}
+
+// embeddingPrice returns the price of the model an embedding attempt will use, nil if unknown
+func (cs *ChatService) embeddingPrice(attempt providerAttempt) *providers.Pricing {
+	return cs.prices.Price(attempt.provider.GetName(), embeddingTarget(attempt))
+}
+
+// newEmbeddingResponse converts an embedding result into the OpenAI response format
+func newEmbeddingResponse(result *providers.EmbeddingResult, provider, encodingFormat string) *models.EmbeddingResponse {
+	response := &models.EmbeddingResponse{
+		Object:   "list",
+		Data:     make([]models.EmbeddingData, len(result.Vectors)),
+		Model:    result.Model,
+		Usage:    result.Usage,
+		Provider: provider,
+	}
+
+	for i, vector := range result.Vectors {
+		var embedding interface{} = vector
+		if encodingFormat == models.EncodingFormatBase64 {
+			embedding = encodeEmbedding(vector)
+		}
+		response.Data[i] = models.EmbeddingData{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: embedding,
+		}
+	}
+	return response
+}
+
+// encodeEmbedding encodes a vector the way OpenAI does for encoding_format=base64:
+// little-endian float32 values, base64 encoded
+func encodeEmbedding(vector []float64) string {
+	buf := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
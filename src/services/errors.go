@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// invalidRequest returns an InvalidArgument error for a request the caller has to fix
+func invalidRequest(format string, args ...interface{}) error {
+	return &errs.Error{Code: errs.InvalidArgument, Message: fmt.Sprintf(format, args...)}
+}
+
+// unavailable returns an Unavailable error for a request no provider can serve
+func unavailable(format string, args ...interface{}) error {
+	return &errs.Error{Code: errs.Unavailable, Message: fmt.Sprintf(format, args...)}
+}
+
+// ToAPIError converts an error from the service or a provider into an Encore error
+// with a matching code. Upstream failures carry ProviderErrorDetails.
+func ToAPIError(err error) *errs.Error {
+	var apiErr *errs.Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &errs.Error{Code: errs.DeadlineExceeded, Message: "upstream request timed out: " + err.Error()}
+	case errors.Is(err, context.Canceled):
+		return &errs.Error{Code: errs.Canceled, Message: "request canceled"}
+	}
+
+	var limitErr *RateLimitError
+	if errors.As(err, &limitErr) {
+		return &errs.Error{Code: errs.ResourceExhausted, Message: limitErr.Error()}
+	}
+
+	var budgetErr *BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		return &errs.Error{Code: errs.ResourceExhausted, Message: budgetErr.Error()}
+	}
+
+	// Checked before APIError, which it may wrap
+	var invalidErr *providers.InvalidRequestError
+	if errors.As(err, &invalidErr) {
+		details := models.ProviderErrorDetails{Provider: invalidErr.Provider}
+		if upstreamErr, ok := invalidErr.Err.(*providers.APIError); ok {
+			details.UpstreamStatus = upstreamErr.StatusCode
+		}
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: fmt.Sprintf("provider %s: %s", invalidErr.Provider, invalidErr.Message),
+			Details: details,
+		}
+	}
+
+	var upstreamErr *providers.APIError
+	if errors.As(err, &upstreamErr) {
+		return &errs.Error{
+			Code:    upstreamCode(upstreamErr.StatusCode),
+			Message: fmt.Sprintf("provider %s: %s", upstreamErr.Provider, upstreamErr.Message()),
+			Details: models.ProviderErrorDetails{
+				Provider:       upstreamErr.Provider,
+				UpstreamStatus: upstreamErr.StatusCode,
+				Retryable:      upstreamErr.Retryable,
+			},
+		}
+	}
+
+	// The transport error is only logged by the provider, it may name internal hosts
+	var reqErr *providers.RequestError
+	if errors.As(err, &reqErr) {
+		return &errs.Error{
+			Code:    errs.Unavailable,
+			Message: fmt.Sprintf("provider %s unreachable", reqErr.Provider),
+			Details: models.ProviderErrorDetails{Provider: reqErr.Provider, Retryable: true},
+		}
+	}
+
+	var openErr *providers.CircuitOpenError
+	if errors.As(err, &openErr) {
+		return &errs.Error{
+			Code:    errs.Unavailable,
+			Message: openErr.Error(),
+			Details: models.ProviderErrorDetails{Provider: openErr.Provider, Retryable: true},
+		}
+	}
+
+	var paramsErr *providers.UnsupportedParamsError
+	if errors.As(err, &paramsErr) {
+		return &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: paramsErr.Error(),
+			Details: models.ProviderErrorDetails{Provider: paramsErr.Provider},
+		}
+	}
+
+	var outputErr *OutputValidationError
+	if errors.As(err, &outputErr) {
+		return &errs.Error{
+			Code:    errs.Internal,
+			Message: outputErr.Error(),
+			Details: models.ProviderErrorDetails{Provider: outputErr.Provider},
+		}
+	}
+
+	return &errs.Error{Code: errs.Internal, Message: err.Error()}
+}
+
+// upstreamCode maps the HTTP status of a failed upstream call to an error code
+func upstreamCode(status int) errs.ErrCode {
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return errs.Unauthenticated
+	case status == http.StatusPaymentRequired, status == http.StatusTooManyRequests:
+		return errs.ResourceExhausted
+	case status == http.StatusNotFound:
+		return errs.NotFound
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return errs.DeadlineExceeded
+	case status >= http.StatusInternalServerError:
+		return errs.Unavailable
+	case status >= http.StatusBadRequest:
+		return errs.InvalidArgument
+	default:
+		return errs.Unknown
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// providerAttempt is one provider in a request's fallback chain
+type providerAttempt struct {
+	provider providers.Provider
+	apiKey   string
+	model    string
+}
+
+// request returns a copy of req targeting the attempt's model
+func (a *providerAttempt) request(req *models.ChatRequest) *models.ChatRequest {
+	attemptReq := *req
+	attemptReq.Model = a.model
+	return &attemptReq
+}
+
+// targetModel returns the model the attempt requests, the provider default if it names none
+func (a *providerAttempt) targetModel() string {
+	if a.model == "" {
+		return providers.DefaultModel(a.provider)
+	}
+	return a.model
+}
+
+// resolveAttempts resolves the routed targets of a request into callable providers.
+// Providers without an API key are skipped unless there is a single target.
+func (cs *ChatService) resolveAttempts(req *models.ChatRequest) ([]providerAttempt, error) {
+	targets, err := cs.routeRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]providerAttempt, 0, len(targets))
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.provider)
+
+		// Get provider instance
+		provider, err := providers.GetProvider(target.provider)
+		if err != nil {
+			return nil, invalidRequest("%v", err)
+		}
+
+		// Get API key
+		apiKey := cs.config.GetAPIKey(target.provider)
+		if apiKey == "" && cs.config.RequiresAPIKey(target.provider) {
+			if len(targets) == 1 {
+				return nil, unavailable("API key not found for provider: %s", target.provider)
+			}
+			log.Printf("[CHAT] Skipping provider %s in fallback chain: no API key", target.provider)
+			continue
+		}
+
+		attempts = append(attempts, providerAttempt{
+			provider: provider,
+			apiKey:   apiKey,
+			model:    target.model,
+		})
+	}
+
+	if len(attempts) == 0 {
+		return nil, unavailable("no provider with an API key in fallback chain: %v", names)
+	}
+	return attempts, nil
+}
+
+// shouldFallback reports whether a provider error justifies trying the next provider:
+// rate limiting, upstream server errors, network failures, open circuit breakers and
+// parameters the provider does not support do, anything else does not
+func shouldFallback(ctx context.Context, err error) bool {
+	// The caller went away or ran out of time, there is no point in trying another provider
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *providers.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var paramsErr *providers.UnsupportedParamsError
+	if errors.As(err, &paramsErr) {
+		return true
+	}
+
+	var reqErr *providers.RequestError
+	return errors.As(err, &reqErr) || providers.IsCircuitOpen(err)
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// Gateway key format
+const (
+	KeyPrefix        = "gw-" // Start of every gateway-issued key
+	keySecretBytes   = 32    // Random bytes in a key
+	keyDisplayLength = 11    // Characters of the key kept for display, including KeyPrefix
+)
+
+// validScopes lists the scopes a key can be issued with
+var validScopes = []string{models.ScopeChat, models.ScopeEmbeddings, models.ScopeAdmin}
+
+// apiKeyColumns are the columns scanned by scanAPIKey, in order
+const apiKeyColumns = `id, name, key_prefix, scopes, allowed_providers, allowed_models,
+	requests_per_minute, tokens_per_minute, budget_period, token_budget, cost_budget_usd::float8,
+	created_at, last_used_at, revoked_at`
+
+// KeyService issues, revokes and authenticates gateway API keys
+type KeyService struct {
+	db     *sqldb.Database
+	config *config.Config
+}
+
+// NewKeyService creates a new key service storing keys in db
+func NewKeyService(db *sqldb.Database, cfg *config.Config) *KeyService {
+	return &KeyService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// CreateKey issues a new key. Only a hash of the key is stored, the key itself
+// is returned once.
+func (ks *KeyService) CreateKey(ctx context.Context, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, invalidRequest("name is required")
+	}
+	if len(req.Scopes) == 0 {
+		return nil, invalidRequest("at least one scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(validScopes, scope) {
+			return nil, invalidRequest("unknown scope %q, expected one of %v", scope, validScopes)
+		}
+	}
+	for _, name := range req.AllowedProviders {
+		if !ks.config.IsValidProvider(name) {
+			return nil, invalidRequest("unknown provider %q in allowed_providers", name)
+		}
+	}
+	if (req.RequestsPerMinute != nil && *req.RequestsPerMinute < 0) || (req.TokensPerMinute != nil && *req.TokensPerMinute < 0) {
+		return nil, invalidRequest("rate limits must not be negative")
+	}
+	budget, err := validateBudget(req.Budget)
+	if err != nil {
+		return nil, err
+	}
+	budgetPeriod, tokenBudget, costBudget := budgetColumns(budget)
+
+	secret := make([]byte, keySecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	key := KeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	row := ks.db.QueryRow(ctx, `
+		INSERT INTO api_keys (name, key_hash, key_prefix, scopes, allowed_providers, allowed_models, requests_per_minute, tokens_per_minute,
+			budget_period, token_budget, cost_budget_usd)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+apiKeyColumns,
+		req.Name, hashKey(key), key[:keyDisplayLength], req.Scopes, nonNil(req.AllowedProviders), nonNil(req.AllowedModels),
+		req.RequestsPerMinute, req.TokensPerMinute, budgetPeriod, tokenBudget, costBudget)
+	apiKey, err := scanAPIKey(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store key: %v", err)
+	}
+
+	return &models.CreateAPIKeyResponse{Key: key, APIKey: apiKey}, nil
+}
+
+// ListKeys returns every key, including revoked ones, newest first
+func (ks *KeyService) ListKeys(ctx context.Context) (*models.ListAPIKeysResponse, error) {
+	rows, err := ks.db.Query(ctx, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %v", err)
+	}
+	defer rows.Close()
+
+	response := &models.ListAPIKeysResponse{Keys: make([]*models.APIKey, 0)}
+	for rows.Next() {
+		apiKey, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list keys: %v", err)
+		}
+		response.Keys = append(response.Keys, apiKey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list keys: %v", err)
+	}
+	return response, nil
+}
+
+// RevokeKey revokes a key; requests using it are rejected from then on
+func (ks *KeyService) RevokeKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	row := ks.db.QueryRow(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1
+		RETURNING `+apiKeyColumns, id)
+	apiKey, err := scanAPIKey(row)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &errs.Error{Code: errs.NotFound, Message: fmt.Sprintf("API key %d not found", id)}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke key: %v", err)
+	}
+	return apiKey, nil
+}
+
+// Authenticate returns the active key matching token and records its use.
+// The GatewayAdminKey secret is accepted as an admin key so the first keys can be issued.
+func (ks *KeyService) Authenticate(ctx context.Context, token string) (*models.APIKey, error) {
+	if adminKey := ks.config.GetGatewayAdminKey(); adminKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminKey)) == 1 {
+		return &models.APIKey{
+			Name:   "bootstrap",
+			Scopes: []string{models.ScopeAdmin},
+		}, nil
+	}
+
+	if !strings.HasPrefix(token, KeyPrefix) {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid API key"}
+	}
+
+	row := ks.db.QueryRow(ctx, `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns, hashKey(token))
+	apiKey, err := scanAPIKey(row)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &errs.Error{Code: errs.Unauthenticated, Message: "invalid or revoked API key"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up key: %v", err)
+	}
+	return apiKey, nil
+}
+
+// hashKey returns the stored form of a key
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// nonNil returns values, or an empty list for the NOT NULL array columns
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// scanAPIKey scans a row of apiKeyColumns
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	apiKey := &models.APIKey{}
+	var budgetPeriod *string
+	var tokenBudget *int64
+	var costBudget *float64
+	err := row.Scan(
+		&apiKey.ID,
+		&apiKey.Name,
+		&apiKey.Prefix,
+		&apiKey.Scopes,
+		&apiKey.AllowedProviders,
+		&apiKey.AllowedModels,
+		&apiKey.RequestsPerMinute,
+		&apiKey.TokensPerMinute,
+		&budgetPeriod,
+		&tokenBudget,
+		&costBudget,
+		&apiKey.CreatedAt,
+		&apiKey.LastUsedAt,
+		&apiKey.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if budgetPeriod != nil {
+		apiKey.Budget = &models.Budget{Period: *budgetPeriod, Tokens: tokenBudget, CostUSD: costBudget}
+	}
+	return apiKey, nil
+}
+
+// apiKeyContextKey carries the gateway key of the current request
+type apiKeyContextKey struct{}
+
+// WithAPIKey returns a context whose requests are limited to what key allows
+func WithAPIKey(ctx context.Context, key *models.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// apiKeyFrom returns the gateway key of the current request, nil if there is none
+func apiKeyFrom(ctx context.Context) *models.APIKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*models.APIKey)
+	return key
+}
+
+// permitAttempts drops the attempts the gateway key of the request may not use.
+// An attempt without a model is checked against the model defaultModel reports
+// for its provider. The requested model only permits every attempt when it is a
+// configured alias; any other name is checked as the model each attempt uses.
+// Fails when no attempt is left.
+func (cs *ChatService) permitAttempts(ctx context.Context, requested string, attempts []providerAttempt, defaultModel func(providers.Provider) string) ([]providerAttempt, error) {
+	key := apiKeyFrom(ctx)
+	if key == nil {
+		return attempts, nil
+	}
+
+	var names []string
+	if _, ok := cs.config.ResolveAlias(requested); ok {
+		names = []string{requested}
+	}
+
+	permitted := make([]providerAttempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		name := attempt.provider.GetName()
+		model := attempt.model
+		if model == "" {
+			model = defaultModel(attempt.provider)
+		}
+		if key.AllowsProvider(name) && key.AllowsModel(name, model, names...) {
+			permitted = append(permitted, attempt)
+		}
+	}
+
+	if len(permitted) == 0 {
+		target := requested
+		if target == "" {
+			target = attempts[0].provider.GetName() + "/" + defaultModel(attempts[0].provider)
+		}
+		return nil, &errs.Error{Code: errs.PermissionDenied, Message: fmt.Sprintf("API key %q is not allowed to use %s", key.Name, target)}
+	}
+	return permitted, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// fakeProvider is a provider that is never called
+type fakeProvider struct {
+	name         string
+	defaultModel string
+}
+
+func (p *fakeProvider) GetName() string {
+	return p.name
+}
+
+func (p *fakeProvider) ChatCompletion(ctx context.Context, req *models.ChatRequest, apiKey string) (*models.ChatResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakeProvider) DefaultModel() string {
+	return p.defaultModel
+}
+
+// fakeEmbedder is an embedding provider that reports usage for every input it embeds
+type fakeEmbedder struct {
+	fakeProvider
+	tokensPerInput int
+	calls          int
+}
+
+func (p *fakeEmbedder) EmbeddingModel() string {
+	return p.defaultModel
+}
+
+func (p *fakeEmbedder) Embeddings(ctx context.Context, req *models.EmbeddingRequest, apiKey string) (*providers.EmbeddingResult, error) {
+	p.calls++
+	result := &providers.EmbeddingResult{Model: p.defaultModel}
+	for range req.Input {
+		result.Vectors = append(result.Vectors, []float64{1, 0})
+		result.Usage.PromptTokens += p.tokensPerInput
+		result.Usage.TotalTokens += p.tokensPerInput
+	}
+	return result, nil
+}
+
+func TestPermitAttempts(t *testing.T) {
+	cs := &ChatService{config: &config.Config{
+		Router: config.RouterConfig{Aliases: map[string][]string{"fast": {"groq/llama-3.1-8b-instant", "gemini/gemini-2.5-flash"}}},
+	}}
+	groq := &fakeProvider{name: "groq", defaultModel: "llama-3.3-70b-versatile"}
+	gemini := &fakeProvider{name: "gemini", defaultModel: "gemini-2.5-flash"}
+	chain := []providerAttempt{{provider: groq, model: "llama-3.1-8b-instant"}, {provider: gemini, model: "gemini-2.5-flash"}}
+
+	tests := []struct {
+		name      string
+		key       *models.APIKey
+		requested string
+		attempts  []providerAttempt
+		want      []string // Providers of the permitted attempts, nil if denied
+	}{
+		{"no key", nil, "", chain, []string{"groq", "gemini"}},
+		{"unrestricted key", &models.APIKey{Name: "k"}, "", chain, []string{"groq", "gemini"}},
+		{"allowed provider", &models.APIKey{Name: "k", AllowedProviders: []string{"gemini"}}, "", chain, []string{"gemini"}},
+		{"allowed model", &models.APIKey{Name: "k", AllowedModels: []string{"llama-3.1-8b-instant"}}, "", chain, []string{"groq"}},
+		{"allowed provider/model", &models.APIKey{Name: "k", AllowedModels: []string{"gemini/gemini-2.5-flash"}}, "", chain, []string{"gemini"}},
+		{"default model", &models.APIKey{Name: "k", AllowedModels: []string{"groq/llama-3.3-70b-versatile"}}, "", []providerAttempt{{provider: groq}}, []string{"groq"}},
+		{"allowed alias", &models.APIKey{Name: "k", AllowedModels: []string{"fast"}}, "fast", chain, []string{"groq", "gemini"}},
+		// A name that is not an alias is passed to other providers as is, so it must not permit them
+		{"allowed name is not an alias", &models.APIKey{Name: "k", AllowedModels: []string{"cheap"}}, "cheap", []providerAttempt{{provider: gemini, model: "gemini-2.5-pro"}}, nil},
+		{"nothing allowed", &models.APIKey{Name: "k", AllowedProviders: []string{"atlas"}}, "", chain, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.key != nil {
+				ctx = WithAPIKey(ctx, tt.key)
+			}
+
+			permitted, err := cs.permitAttempts(ctx, tt.requested, tt.attempts, providers.DefaultModel)
+			if tt.want == nil {
+				var apiErr *errs.Error
+				if !errors.As(err, &apiErr) || apiErr.Code != errs.PermissionDenied {
+					t.Fatalf("got %v, want a permission denied error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, attempt := range permitted {
+				got = append(got, attempt.provider.GetName())
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got providers %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got providers %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
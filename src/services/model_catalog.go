@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// Model list caching
+const (
+	ModelCacheTTL        = 10 * time.Minute // How long a provider's merged model list is reused
+	ModelCacheFailureTTL = time.Minute      // How long to wait before asking an unreachable provider again
+	modelListTimeout     = 5 * time.Second  // Bound for a single live model list call
+)
+
+// modelCacheEntry is the cached model list of a provider
+type modelCacheEntry struct {
+	models  []providers.ModelInfo
+	expires time.Time
+}
+
+// modelCache caches the merged model list of each provider
+type modelCache struct {
+	mu      sync.Mutex
+	entries map[string]modelCacheEntry
+}
+
+// newModelCache creates an empty model cache
+func newModelCache() *modelCache {
+	return &modelCache{entries: make(map[string]modelCacheEntry)}
+}
+
+// get returns the cached model list of a provider, if it has not expired
+func (c *modelCache) get(provider string) ([]providers.ModelInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[provider]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.models, true
+}
+
+// set caches the model list of a provider for ttl
+func (c *modelCache) set(provider string, modelList []providers.ModelInfo, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[provider] = modelCacheEntry{models: modelList, expires: time.Now().Add(ttl)}
+}
+
+// ListModels returns the models of every configured provider, merging the
+// static catalog with the provider's live model list when it is reachable,
+// followed by the configured model aliases. Models the caller's gateway key may
+// not use are left out.
+func (cs *ChatService) ListModels(ctx context.Context) *models.ModelsResponse {
+	key := apiKeyFrom(ctx)
+	names := make([]string, 0)
+	for _, name := range cs.config.GetSupportedProviders() {
+		if cs.config.IsConfigured(name) && (key == nil || key.AllowsProvider(name)) {
+			names = append(names, name)
+		}
+	}
+
+	// Ask the providers in parallel so one slow provider does not add up
+	lists := make([][]providers.ModelInfo, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lists[i] = cs.providerModels(ctx, name)
+		}()
+	}
+	wg.Wait()
+
+	response := &models.ModelsResponse{
+		Object: "list",
+		Data:   make([]models.ModelEntry, 0),
+	}
+	for i, name := range names {
+		for _, info := range lists[i] {
+			if key != nil && !key.AllowsModel(name, info.ID) {
+				continue
+			}
+			entry := models.ModelEntry{
+				ID:             name + "/" + info.ID, // Routable as is, see routeRequest
+				Object:         "model",
+				OwnedBy:        name,
+				Provider:       name,
+				ContextWindow:  info.ContextWindow,
+				SupportsVision: info.Vision,
+				SupportsTools:  info.Tools,
+			}
+			if info.Pricing != nil {
+				entry.Pricing = &models.ModelPricing{
+					Input:  info.Pricing.Input,
+					Output: info.Pricing.Output,
+				}
+			}
+			response.Data = append(response.Data, entry)
+		}
+	}
+
+	// Aliases are listed under their first target's provider
+	aliases := make([]string, 0, len(cs.config.Router.Aliases))
+	for alias := range cs.config.Router.Aliases {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	for _, alias := range aliases {
+		targets, _ := cs.config.ResolveAlias(alias)
+		provider, _, _ := cs.config.SplitModel(targets[0])
+		if key != nil && !(key.AllowsProvider(provider) && key.AllowsModel(provider, alias)) {
+			continue
+		}
+		response.Data = append(response.Data, models.ModelEntry{
+			ID:       alias,
+			Object:   "model",
+			OwnedBy:  provider,
+			Provider: provider,
+		})
+	}
+	return response
+}
+
+// providerModels returns the merged model list of a provider, from the cache if possible
+func (cs *ChatService) providerModels(ctx context.Context, name string) []providers.ModelInfo {
+	if cached, ok := cs.models.get(name); ok {
+		return cached
+	}
+
+	catalog, err := providers.GetCatalog(name)
+	if err != nil {
+		log.Printf("[CHAT] No model catalog for provider %s: %v", name, err)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, modelListTimeout)
+	defer cancel()
+
+	live, err := providers.ListModels(ctx, name, cs.config.GetAPIKey(name))
+	if err != nil {
+		// A caller that went away says nothing about the provider, don't cache
+		if ctx.Err() == context.Canceled {
+			return catalog
+		}
+		log.Printf("[CHAT] Failed to list models of provider %s, using static catalog: %v", name, err)
+		cs.models.set(name, catalog, ModelCacheFailureTTL)
+		return catalog
+	}
+
+	merged := mergeModels(catalog, live)
+	cs.models.set(name, merged, ModelCacheTTL)
+	return merged
+}
+
+// mergeModels merges a live model list into the static catalog. Catalog
+// entries come first and keep their metadata, filling in only what they lack;
+// live models missing from the catalog are appended.
+func mergeModels(catalog, live []providers.ModelInfo) []providers.ModelInfo {
+	merged := make([]providers.ModelInfo, len(catalog), len(catalog)+len(live))
+	copy(merged, catalog)
+
+	index := make(map[string]int, len(catalog))
+	for i, info := range catalog {
+		index[info.ID] = i
+	}
+
+	for _, info := range live {
+		if i, ok := index[info.ID]; ok {
+			if merged[i].ContextWindow == 0 {
+				merged[i].ContextWindow = info.ContextWindow
+			}
+			continue
+		}
+		index[info.ID] = len(merged)
+		merged = append(merged, info)
+	}
+	return merged
+}
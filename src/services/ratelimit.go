@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+// Rate limited resources
+const (
+	LimitRequests = "requests"
+	LimitTokens   = "tokens"
+)
+
+// RateLimitError is returned when a gateway key or provider has exhausted its rate limit
+type RateLimitError struct {
+	Scope      string // "key <name>" for a gateway key, otherwise the name of the provider
+	Limit      string // LimitRequests or LimitTokens
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %s exceeded: too many %s, retry in %s", e.Scope, e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+// RateLimitStatus describes the state of a gateway key's limits after admitting a request,
+// as reported in the x-ratelimit-* response headers. Zero limits are unlimited.
+type RateLimitStatus struct {
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration // Time until the request budget is full again
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration
+}
+
+// tokenBucket holds up to capacity units and refills continuously at capacity per minute
+type tokenBucket struct {
+	capacity float64
+	level    float64
+	updated  time.Time
+}
+
+// newTokenBucket creates a full bucket for a per-minute limit
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	return &tokenBucket{capacity: float64(perMinute), level: float64(perMinute), updated: now}
+}
+
+// refill adds the units accrued since the last update
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Minutes()
+	b.level = math.Min(b.capacity, b.level+elapsed*b.capacity)
+	b.updated = now
+}
+
+// wait returns how long until n units are available
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.capacity * float64(time.Minute))
+}
+
+// remaining returns the whole units available, never negative
+func (b *tokenBucket) remaining() int {
+	return max(0, int(b.level))
+}
+
+// reset returns how long until the bucket is full again
+func (b *tokenBucket) reset() time.Duration {
+	return b.wait(b.capacity)
+}
+
+// rateBuckets are the request and token buckets of one limited key, nil if unlimited
+type rateBuckets struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+// rateBucketSweepInterval is how often the buckets of idle keys are dropped
+const rateBucketSweepInterval = time.Minute
+
+// RateLimiter enforces per-minute request and token limits with in-memory token buckets
+type RateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBuckets
+	swept   time.Time
+}
+
+// NewRateLimiter creates a rate limiter with no buckets
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*rateBuckets)}
+}
+
+// take admits one request of tokens under limit for the key id, or returns a
+// RateLimitError naming scope. A request larger than the whole token budget is
+// admitted when the budget is full, otherwise it could never pass.
+func (l *RateLimiter) take(id, scope string, limit config.RateLimit, tokens int) (*RateLimitStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	buckets := l.bucketsFor(id, limit, now)
+
+	needed := float64(tokens)
+	if buckets.tokens != nil {
+		needed = math.Min(needed, buckets.tokens.capacity)
+	}
+	if buckets.requests != nil {
+		if wait := buckets.requests.wait(1); wait > 0 {
+			return buckets.status(), &RateLimitError{Scope: scope, Limit: LimitRequests, RetryAfter: wait}
+		}
+	}
+	if buckets.tokens != nil {
+		if wait := buckets.tokens.wait(needed); wait > 0 {
+			return buckets.status(), &RateLimitError{Scope: scope, Limit: LimitTokens, RetryAfter: wait}
+		}
+	}
+
+	if buckets.requests != nil {
+		buckets.requests.level--
+	}
+	if buckets.tokens != nil {
+		buckets.tokens.level -= float64(tokens)
+	}
+	return buckets.status(), nil
+}
+
+// adjust corrects the tokens charged to the key id once the real usage is known;
+// a negative delta refunds tokens
+func (l *RateLimiter) adjust(id string, delta int) {
+	if delta == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets, ok := l.buckets[id]
+	if !ok || buckets.tokens == nil {
+		return
+	}
+	buckets.tokens.refill(time.Now())
+	buckets.tokens.level = math.Min(buckets.tokens.capacity, buckets.tokens.level-float64(delta))
+}
+
+// bucketsFor returns the refilled buckets of the key id, recreating them if the limit changed
+func (l *RateLimiter) bucketsFor(id string, limit config.RateLimit, now time.Time) *rateBuckets {
+	buckets, ok := l.buckets[id]
+	if !ok || !buckets.matches(limit) {
+		buckets = &rateBuckets{}
+		if limit.RequestsPerMinute > 0 {
+			buckets.requests = newTokenBucket(limit.RequestsPerMinute, now)
+		}
+		if limit.TokensPerMinute > 0 {
+			buckets.tokens = newTokenBucket(limit.TokensPerMinute, now)
+		}
+		l.buckets[id] = buckets
+	}
+
+	if buckets.requests != nil {
+		buckets.requests.refill(now)
+	}
+	if buckets.tokens != nil {
+		buckets.tokens.refill(now)
+	}
+	return buckets
+}
+
+// sweep drops the buckets that have refilled completely, at most once per
+// rateBucketSweepInterval. A full bucket is the same as a new one, so no
+// limit is lost; the caller holds the lock.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateBucketSweepInterval {
+		return
+	}
+	l.swept = now
+
+	for id, buckets := range l.buckets {
+		if buckets.full(now) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// full reports whether both buckets are full at now
+func (b *rateBuckets) full(now time.Time) bool {
+	for _, bucket := range []*tokenBucket{b.requests, b.tokens} {
+		if bucket == nil {
+			continue
+		}
+		bucket.refill(now)
+		if bucket.level < bucket.capacity {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the buckets were created for limit
+func (b *rateBuckets) matches(limit config.RateLimit) bool {
+	return bucketCapacity(b.requests) == limit.RequestsPerMinute && bucketCapacity(b.tokens) == limit.TokensPerMinute
+}
+
+// bucketCapacity returns the per-minute limit of a bucket, 0 for none
+func bucketCapacity(b *tokenBucket) int {
+	if b == nil {
+		return 0
+	}
+	return int(b.capacity)
+}
+
+// status reports the current state of the buckets
+func (b *rateBuckets) status() *RateLimitStatus {
+	status := &RateLimitStatus{}
+	if b.requests != nil {
+		status.LimitRequests = int(b.requests.capacity)
+		status.RemainingRequests = b.requests.remaining()
+		status.ResetRequests = b.requests.reset()
+	}
+	if b.tokens != nil {
+		status.LimitTokens = int(b.tokens.capacity)
+		status.RemainingTokens = b.tokens.remaining()
+		status.ResetTokens = b.tokens.reset()
+	}
+	return status
+}
+
+// rateReservation records the tokens charged to a gateway key for a request
+type rateReservation struct {
+	bucket  string
+	tokens  int
+	settled bool
+}
+
+// rateReservationKey carries the rateReservation of the current request
+type rateReservationKey struct{}
+
+// CheckRateLimit admits a chat request under the rate limit of the caller's gateway
+// key, charging its estimated tokens. The returned context lets the chat service
+// correct the charge once the real usage is known. The status is nil when the
+// request has no gateway key; it is also returned when the limit is exceeded.
+func (cs *ChatService) CheckRateLimit(ctx context.Context, req *models.ChatRequest) (context.Context, *RateLimitStatus, error) {
+	return cs.reserveKey(ctx, estimateRequestTokens(req))
+}
+
+// CheckEmbeddingsRateLimit admits an embeddings request like CheckRateLimit does a chat request
+func (cs *ChatService) CheckEmbeddingsRateLimit(ctx context.Context, req *models.EmbeddingRequest) (context.Context, *RateLimitStatus, error) {
+	return cs.reserveKey(ctx, estimateEmbeddingTokens(req))
+}
+
+// reserveKey charges tokens to the rate limit of the caller's gateway key
+func (cs *ChatService) reserveKey(ctx context.Context, tokens int) (context.Context, *RateLimitStatus, error) {
+	key := apiKeyFrom(ctx)
+	if key == nil {
+		return ctx, nil, nil
+	}
+
+	limit := cs.config.RateLimits.Key
+	if key.RequestsPerMinute != nil {
+		limit.RequestsPerMinute = *key.RequestsPerMinute
+	}
+	if key.TokensPerMinute != nil {
+		limit.TokensPerMinute = *key.TokensPerMinute
+	}
+
+	bucket := "key:" + strconv.FormatInt(key.ID, 10)
+	status, err := cs.limiter.take(bucket, "key "+key.Name, limit, tokens)
+	if err != nil {
+		return ctx, status, err
+	}
+	return context.WithValue(ctx, rateReservationKey{}, &rateReservation{bucket: bucket, tokens: tokens}), status, nil
+}
+
+// admitProvider admits a request under the rate limit of a provider's upstream key
+func (cs *ChatService) admitProvider(provider string, tokens int) error {
+	limit, ok := cs.config.RateLimits.Providers[provider]
+	if !ok {
+		return nil
+	}
+	_, err := cs.limiter.take("provider:"+provider, provider, limit, tokens)
+	return err
+}
+
+// settleProvider corrects the tokens charged to a provider once the real usage is known
+func (cs *ChatService) settleProvider(provider string, estimated, used int) {
+	cs.limiter.adjust("provider:"+provider, used-estimated)
+}
+
+// settleKey corrects the tokens charged to the caller's gateway key by CheckRateLimit.
+// Only the first call per request counts, so a deferred settleKey(ctx, 0) refunds
+// a request that returns before it settled.
+func (cs *ChatService) settleKey(ctx context.Context, used int) {
+	if reservation, ok := ctx.Value(rateReservationKey{}).(*rateReservation); ok && !reservation.settled {
+		reservation.settled = true
+		cs.limiter.adjust(reservation.bucket, used-reservation.tokens)
+	}
+}
+
+// usedTokens returns the tokens reported in usage, or the estimate if the provider reported none
+func usedTokens(usage *models.Usage, estimate int) int {
+	if usage == nil || usage.TotalTokens == 0 {
+		return estimate
+	}
+	return usage.TotalTokens
+}
+
+// estimateRequestTokens approximates the tokens a chat request can use: its prompt
+// at four characters per token plus the completion tokens it may generate
+func estimateRequestTokens(req *models.ChatRequest) int {
+	maxTokens := DefaultMaxTokens
+	if req.MaxTokens != nil {
+		maxTokens = *req.MaxTokens
+	}
+	choices := 1
+	if req.N != nil && *req.N > 1 {
+		choices = *req.N
+	}
+	return estimatePromptTokens(req) + maxTokens*choices
+}
+
+// estimatePromptTokens approximates the tokens of a chat request's prompt at four characters per token
+func estimatePromptTokens(req *models.ChatRequest) int {
+	chars := 0
+	if len(req.Messages) == 0 {
+		chars = utf8.RuneCountInString(req.Prompt)
+	}
+	for i := range req.Messages {
+		chars += utf8.RuneCountInString(req.Messages[i].Text())
+	}
+	return estimateTextTokens(chars)
+}
+
+// estimateEmbeddingTokens approximates the tokens of an embeddings request's inputs
+func estimateEmbeddingTokens(req *models.EmbeddingRequest) int {
+	tokens := 0
+	for _, text := range req.Input {
+		tokens += estimateTextTokens(utf8.RuneCountInString(text))
+	}
+	return tokens
+}
+
+// estimateTextTokens approximates the tokens of a text of chars characters
+func estimateTextTokens(chars int) int {
+	return (chars + 3) / 4
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name      string
+		take      float64
+		elapsed   time.Duration
+		want      int
+		wantWait  time.Duration
+		waitFor   float64
+		wantReset time.Duration
+	}{
+		{"full", 0, 0, 60, 0, 60, 0},
+		{"taken", 30, 0, 30, 30 * time.Second, 60, 30 * time.Second},
+		{"refilled", 30, 15 * time.Second, 45, 0, 45, 15 * time.Second},
+		{"capped at capacity", 30, time.Hour, 60, 0, 60, 0},
+		{"overdrawn", 90, 0, 0, 90 * time.Second, 60, 90 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(60, start)
+			b.level -= tt.take
+			b.refill(start.Add(tt.elapsed))
+
+			if got := b.remaining(); got != tt.want {
+				t.Errorf("remaining() = %d, want %d", got, tt.want)
+			}
+			if got := b.wait(tt.waitFor); got != tt.wantWait {
+				t.Errorf("wait(%v) = %v, want %v", tt.waitFor, got, tt.wantWait)
+			}
+			if got := b.reset(); got != tt.wantReset {
+				t.Errorf("reset() = %v, want %v", got, tt.wantReset)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTakeAndAdjust(t *testing.T) {
+	limit := config.RateLimit{RequestsPerMinute: 2, TokensPerMinute: 1000}
+
+	tests := []struct {
+		name          string
+		takes         []int // Tokens of each admitted request
+		adjust        int   // Correction applied after the takes
+		take          int   // Tokens of the final request
+		wantLimit     string
+		wantRemaining int // Remaining tokens after the final request, if admitted
+	}{
+		{"admitted", nil, 0, 400, "", 600},
+		{"too many tokens", []int{800}, 0, 400, LimitTokens, 0},
+		{"refund makes room", []int{800}, -500, 400, "", 300},
+		{"larger than the budget when full", nil, 0, 5000, "", 0},
+		{"too many requests", []int{1, 1}, 0, 1, LimitRequests, 0},
+		{"refund capped at capacity", []int{100}, -5000, 400, "", 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter()
+			for _, tokens := range tt.takes {
+				if _, err := l.take("key:1", "key test", limit, tokens); err != nil {
+					t.Fatalf("take(%d) failed: %v", tokens, err)
+				}
+			}
+			l.adjust("key:1", tt.adjust)
+
+			status, err := l.take("key:1", "key test", limit, tt.take)
+			if tt.wantLimit != "" {
+				var limitErr *RateLimitError
+				if !errors.As(err, &limitErr) || limitErr.Limit != tt.wantLimit {
+					t.Fatalf("got %v, want a %s rate limit error", err, tt.wantLimit)
+				}
+				if limitErr.RetryAfter <= 0 {
+					t.Errorf("RetryAfter = %v, want > 0", limitErr.RetryAfter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status.RemainingTokens != tt.wantRemaining {
+				t.Errorf("remaining tokens = %d, want %d", status.RemainingTokens, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	start := time.Now()
+	limit := config.RateLimit{RequestsPerMinute: 60, TokensPerMinute: 1000}
+
+	tests := []struct {
+		name     string
+		tokens   int           // Tokens taken by the bucket's only request
+		elapsed  time.Duration // Time of the sweep after the request
+		swept    time.Duration // Time of the previous sweep after the request, if any
+		wantKept bool
+	}{
+		{"refilling", 100, 3 * time.Second, 0, true},
+		{"requests bucket refilling", 0, 500 * time.Millisecond, 0, true},
+		{"refilled", 100, 2 * time.Minute, 0, false},
+		{"idle but swept recently", 100, 2 * time.Minute, 90 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter()
+			l.bucketsFor("key:1", limit, start)
+			buckets := l.buckets["key:1"]
+			buckets.requests.level--
+			buckets.tokens.level -= float64(tt.tokens)
+			if tt.swept > 0 {
+				l.swept = start.Add(tt.swept)
+			}
+
+			l.sweep(start.Add(tt.elapsed))
+			if _, kept := l.buckets["key:1"]; kept != tt.wantKept {
+				t.Fatalf("bucket kept %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestSettleKey(t *testing.T) {
+	limit := 10000
+	cs := &ChatService{
+		config:  &config.Config{RateLimits: config.RateLimitConfig{Key: config.RateLimit{TokensPerMinute: limit}}},
+		limiter: NewRateLimiter(),
+	}
+	req := &models.ChatRequest{Prompt: "hi"} // Estimated at 1 prompt token plus DefaultMaxTokens
+
+	tests := []struct {
+		name     string
+		settles  []int // Tokens of each settleKey call
+		wantUsed int
+	}{
+		{"refunded when never settled", []int{0}, 0},
+		{"settled with the usage", []int{300}, 300},
+		{"usage above the estimate", []int{1500}, 1500},
+		{"only the first settle counts", []int{300, 0}, 300},
+		{"deferred refund after a settle", []int{300, 0, 0}, 300},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := &models.APIKey{ID: int64(i + 1), Name: "test"}
+			ctx, _, err := cs.CheckRateLimit(WithAPIKey(context.Background(), key), req)
+			if err != nil {
+				t.Fatalf("CheckRateLimit failed: %v", err)
+			}
+
+			for _, used := range tt.settles {
+				cs.settleKey(ctx, used)
+			}
+			bucket := "key:" + strconv.FormatInt(key.ID, 10)
+			if got := limit - cs.limiter.buckets[bucket].status().RemainingTokens; got != tt.wantUsed {
+				t.Errorf("%d tokens charged, want %d", got, tt.wantUsed)
+			}
+		})
+	}
+
+	// A request without a reservation has nothing to settle
+	cs.settleKey(context.Background(), 100)
+}
+
+func TestRateLimitRefundedOnEarlyReturn(t *testing.T) {
+	limit := 10000
+	cs := &ChatService{
+		config:  &config.Config{RateLimits: config.RateLimitConfig{Key: config.RateLimit{TokensPerMinute: limit}}},
+		limiter: NewRateLimiter(),
+	}
+	ctx := WithAPIKey(context.Background(), &models.APIKey{ID: 1, Name: "test"})
+
+	tests := []struct {
+		name string
+		req  *models.ChatRequest
+	}{
+		{"no messages", &models.ChatRequest{}},
+		{"unknown cache mode", &models.ChatRequest{Prompt: "hi", Cache: "forever"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, status, err := cs.CheckRateLimit(ctx, tt.req)
+			if err != nil {
+				t.Fatalf("CheckRateLimit failed: %v", err)
+			}
+			if status.RemainingTokens == limit {
+				t.Fatalf("CheckRateLimit charged nothing")
+			}
+
+			if _, err := cs.ProcessChatCompletion(ctx, tt.req); err == nil {
+				t.Fatalf("ProcessChatCompletion succeeded, want an error")
+			}
+			if got := cs.limiter.buckets["key:1"].status().RemainingTokens; got != limit {
+				t.Errorf("remaining tokens = %d after the request failed, want %d", got, limit)
+			}
+		})
+	}
+}
+
+func TestEmbeddingsRateLimit(t *testing.T) {
+	embedder := &fakeEmbedder{fakeProvider: fakeProvider{name: "embedder", defaultModel: "embed-1"}, tokensPerInput: 7}
+	registerProvider(t, "embedder", embedder)
+	registerProvider(t, "chatter", &fakeProvider{name: "chatter", defaultModel: "chat-1"})
+
+	limit := 10000
+	cfg := &config.Config{
+		CustomProviders: []config.CustomProvider{
+			{Name: "embedder", AuthScheme: config.AuthSchemeNone},
+			{Name: "chatter", AuthScheme: config.AuthSchemeNone},
+		},
+		RateLimits: config.RateLimitConfig{
+			Key:       config.RateLimit{TokensPerMinute: limit},
+			Providers: map[string]config.RateLimit{"embedder": {TokensPerMinute: limit}},
+		},
+	}
+	cs := &ChatService{config: cfg, prices: NewModelPrices(cfg), limiter: NewRateLimiter()}
+
+	tests := []struct {
+		name      string
+		provider  string
+		wantCode  errs.ErrCode // Expected error code, OK if the request succeeds
+		wantUsed  int          // Tokens left charged to the key and the provider
+		wantCalls int
+	}{
+		{"charged the reported usage", "embedder", errs.OK, 14, 1},
+		{"provider cannot embed", "chatter", errs.InvalidArgument, 0, 0},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder.calls = 0
+			key := &models.APIKey{ID: int64(i + 1), Name: "test"}
+			req := &models.EmbeddingRequest{Input: models.EmbeddingInput{"a long first input", "a second one"}, Provider: models.ProviderList{tt.provider}}
+
+			ctx, status, err := cs.CheckEmbeddingsRateLimit(WithAPIKey(context.Background(), key), req)
+			if err != nil {
+				t.Fatalf("CheckEmbeddingsRateLimit failed: %v", err)
+			}
+			if status.RemainingTokens == limit {
+				t.Fatalf("CheckEmbeddingsRateLimit charged nothing")
+			}
+
+			_, err = cs.ProcessEmbeddings(ctx, req)
+			code := errs.OK
+			var apiErr *errs.Error
+			if errors.As(err, &apiErr) {
+				code = apiErr.Code
+			} else if err != nil {
+				code = errs.Unknown
+			}
+			if code != tt.wantCode {
+				t.Fatalf("got error %v, want code %v", err, tt.wantCode)
+			}
+			if embedder.calls != tt.wantCalls {
+				t.Errorf("%d upstream calls, want %d", embedder.calls, tt.wantCalls)
+			}
+			bucket := "key:" + strconv.FormatInt(key.ID, 10)
+			if got := limit - cs.limiter.buckets[bucket].status().RemainingTokens; got != tt.wantUsed {
+				t.Errorf("%d tokens charged to the key, want %d", got, tt.wantUsed)
+			}
+		})
+	}
+
+	if got := limit - cs.limiter.buckets["provider:embedder"].status().RemainingTokens; got != 14 {
+		t.Errorf("%d tokens charged to the provider, want 14", got)
+	}
+}
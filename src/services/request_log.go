@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"encore.dev/storage/sqldb"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+// Request log page sizes
+const (
+	DefaultRequestLogLimit = 50
+	MaxRequestLogLimit     = 500
+)
+
+// requestLogColumns are the columns scanned by scanRequestLogEntry, in order; JSONB columns are read as text
+const requestLogColumns = `id, request_id, created_at, endpoint, api_key_id, api_key_name, provider, model,
+	requested_model, stream, parameters::text, status, error, finish_reason, latency_ms,
+	prompt_tokens, completion_tokens, total_tokens, cache, request_body::text, response_body::text`
+
+// RequestLog records chat requests in the gateway database
+type RequestLog struct {
+	db          *sqldb.Database
+	storeBodies bool
+}
+
+// NewRequestLog creates a new request log writing to db
+func NewRequestLog(db *sqldb.Database, cfg *config.Config) *RequestLog {
+	return &RequestLog{
+		db:          db,
+		storeBodies: cfg.RequestLog.StoreBodies,
+	}
+}
+
+// RequestRecord collects what is logged about one request while it is served
+type RequestRecord struct {
+	log     *RequestLog
+	entry   models.RequestLogEntry
+	started time.Time
+
+	// Streamed responses are reassembled from their chunks
+	chunks  int
+	texts   map[int]*strings.Builder
+	reasons map[int]string
+
+	// Estimated usage, metered if the provider reports none
+	promptTokens    int
+	completionChars int
+}
+
+// Begin starts recording a chat request to endpoint. It must be called before the
+// chat service applies defaults to req, so the request is logged as sent.
+func (l *RequestLog) Begin(ctx context.Context, endpoint string, req *models.ChatRequest) *RequestRecord {
+	record := l.begin(ctx, endpoint, req.Model, requestParameters(req), req)
+	record.entry.Stream = req.Stream != nil && *req.Stream
+	record.promptTokens = estimatePromptTokens(req)
+	return record
+}
+
+// BeginEmbeddings starts recording an embeddings request to endpoint
+func (l *RequestLog) BeginEmbeddings(ctx context.Context, endpoint string, req *models.EmbeddingRequest) *RequestRecord {
+	record := l.begin(ctx, endpoint, req.Model, jsonParameters(req, "input"), req)
+	for _, text := range req.Input {
+		record.promptTokens += estimateTextTokens(utf8.RuneCountInString(text))
+	}
+	return record
+}
+
+// begin starts recording a request with the calling key from ctx
+func (l *RequestLog) begin(ctx context.Context, endpoint, model string, parameters json.RawMessage, body interface{}) *RequestRecord {
+	record := &RequestRecord{
+		log:     l,
+		started: time.Now(),
+		texts:   make(map[int]*strings.Builder),
+		reasons: make(map[int]string),
+		entry: models.RequestLogEntry{
+			RequestID:      newRequestID(),
+			Endpoint:       endpoint,
+			RequestedModel: model,
+			Parameters:     parameters,
+		},
+	}
+
+	if key := apiKeyFrom(ctx); key != nil {
+		record.entry.APIKeyName = key.Name
+		if key.ID != 0 {
+			record.entry.APIKeyID = &key.ID
+		}
+	}
+	if l.storeBodies {
+		record.entry.RequestBody, _ = json.Marshal(body)
+	}
+	return record
+}
+
+// requestIDContextKey carries the ID of the request being served
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context for serving the request id, so that calls the
+// gateway makes on its behalf are metered under the same ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// requestIDFrom returns the ID of the request being served, empty if there is none
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// ID returns the request ID
+func (r *RequestRecord) ID() string {
+	return r.entry.RequestID
+}
+
+// Observe records a streamed chunk
+func (r *RequestRecord) Observe(chunk *models.ChatCompletionChunk) {
+	r.chunks++
+	r.entry.Provider = chunk.Provider
+	r.entry.PricedModel = chunk.PricedModel
+	if chunk.Model != "" {
+		r.entry.Model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		r.entry.Usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.FinishReason != nil {
+			r.reasons[choice.Index] = *choice.FinishReason
+		}
+		r.completionChars += utf8.RuneCountInString(choice.Delta.Content)
+		if !r.log.storeBodies || choice.Delta.Content == "" {
+			continue
+		}
+		text, ok := r.texts[choice.Index]
+		if !ok {
+			text = &strings.Builder{}
+			r.texts[choice.Index] = text
+		}
+		text.WriteString(choice.Delta.Content)
+	}
+}
+
+// Finish completes the record with the response, or the chunks observed for a
+// stream, and the error of the request, stores it and returns the entry. Storing
+// happens even if the caller has gone away; failures are only logged.
+func (r *RequestRecord) Finish(ctx context.Context, response *models.ChatResponse, err error) *models.RequestLogEntry {
+	entry := &r.entry
+	if response == nil && r.chunks > 0 {
+		response = r.streamedResponse()
+	}
+	if response != nil {
+		if response.Provider != "" {
+			entry.Provider = response.Provider
+		}
+		entry.Model = response.Model
+		if response.PricedModel != "" {
+			entry.PricedModel = response.PricedModel
+		}
+		entry.Cache = response.CacheStatus
+		if response.Usage.TotalTokens > 0 {
+			entry.Usage = &response.Usage
+		} else if r.chunks == 0 {
+			for i := range response.Choices {
+				r.completionChars += utf8.RuneCountInString(response.Choices[i].Message.Text())
+			}
+		}
+		if len(response.Choices) > 0 {
+			entry.FinishReason = response.Choices[0].FinishReason
+		}
+		if r.log.storeBodies {
+			entry.ResponseBody, _ = json.Marshal(response)
+		}
+		if entry.Usage == nil {
+			completionTokens := estimateTextTokens(r.completionChars)
+			entry.UsageEstimate = &models.Usage{
+				PromptTokens:     r.promptTokens,
+				CompletionTokens: completionTokens,
+				TotalTokens:      r.promptTokens + completionTokens,
+			}
+		}
+	}
+	return r.finish(ctx, err)
+}
+
+// FinishEmbeddings completes the record with the response and the error of an
+// embeddings request, stores it and returns the entry. Vectors are never stored.
+func (r *RequestRecord) FinishEmbeddings(ctx context.Context, response *models.EmbeddingResponse, err error) *models.RequestLogEntry {
+	entry := &r.entry
+	if response != nil {
+		entry.Provider = response.Provider
+		entry.Model = response.Model
+		entry.PricedModel = response.PricedModel
+		setEmbeddingUsage(entry, response, r.promptTokens)
+	}
+	return r.finish(ctx, err)
+}
+
+// finish records the latency and error of the request and stores the entry
+func (r *RequestRecord) finish(ctx context.Context, err error) *models.RequestLogEntry {
+	entry := &r.entry
+	entry.LatencyMs = time.Since(r.started).Milliseconds()
+	entry.Status = http.StatusOK
+
+	if err != nil {
+		apiErr := ToAPIError(err)
+		entry.Status = apiErr.Code.HTTPStatus()
+		entry.Error = apiErr.Message
+		if details, ok := apiErr.Details.(models.ProviderErrorDetails); ok && details.Provider != "" {
+			entry.Provider = details.Provider
+		}
+	}
+
+	if err := r.log.insert(context.WithoutCancel(ctx), entry); err != nil {
+		log.Printf("[REQUESTS] Failed to log request %s: %v", entry.RequestID, err)
+	}
+	return entry
+}
+
+// streamedResponse reassembles the observed chunks into a response
+func (r *RequestRecord) streamedResponse() *models.ChatResponse {
+	response := &models.ChatResponse{
+		ID:       r.entry.RequestID,
+		Object:   "chat.completion",
+		Created:  r.started.Unix(),
+		Model:    r.entry.Model,
+		Provider: r.entry.Provider,
+	}
+	if r.entry.Usage != nil {
+		response.Usage = *r.entry.Usage
+	}
+
+	choices := max(len(r.texts), len(r.reasons))
+	for i := 0; i < choices; i++ {
+		message := models.ChatMessage{Role: "assistant"}
+		if text, ok := r.texts[i]; ok {
+			message.Content = []models.ContentPart{{Type: "text", Text: text.String()}}
+		}
+		message.SetStringContent(true)
+		response.Choices = append(response.Choices, models.Choice{
+			Index:        i,
+			Message:      message,
+			FinishReason: r.reasons[i],
+		})
+	}
+	return response
+}
+
+// insert stores a finished entry
+func (l *RequestLog) insert(ctx context.Context, entry *models.RequestLogEntry) error {
+	var promptTokens, completionTokens, totalTokens *int
+	if entry.Usage != nil {
+		promptTokens = &entry.Usage.PromptTokens
+		completionTokens = &entry.Usage.CompletionTokens
+		totalTokens = &entry.Usage.TotalTokens
+	}
+
+	_, err := l.db.Exec(ctx, `
+		INSERT INTO request_log (request_id, endpoint, api_key_id, api_key_name, provider, model,
+			requested_model, stream, parameters, status, error, finish_reason, latency_ms,
+			prompt_tokens, completion_tokens, total_tokens, cache, request_body, response_body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::jsonb, $10, $11, $12, $13, $14, $15, $16, $17, $18::jsonb, $19::jsonb)`,
+		entry.RequestID, entry.Endpoint, entry.APIKeyID, entry.APIKeyName, entry.Provider, entry.Model,
+		entry.RequestedModel, entry.Stream, string(entry.Parameters), entry.Status, entry.Error, entry.FinishReason, entry.LatencyMs,
+		promptTokens, completionTokens, totalTokens, entry.Cache, nullableJSON(entry.RequestBody), nullableJSON(entry.ResponseBody))
+	return err
+}
+
+// List returns a page of the request log matching the query, newest first
+func (l *RequestLog) List(ctx context.Context, req *models.ListRequestsRequest) (*models.ListRequestsResponse, error) {
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultRequestLogLimit
+	}
+	if limit > MaxRequestLogLimit {
+		return nil, invalidRequest("limit must be at most %d", MaxRequestLogLimit)
+	}
+
+	filter := &sqlFilter{}
+	if req.Before > 0 {
+		filter.add("id < $%d", req.Before)
+	}
+	if req.KeyID > 0 {
+		filter.add("api_key_id = $%d", req.KeyID)
+	}
+	if req.Provider != "" {
+		filter.add("provider = $%d", req.Provider)
+	}
+	if req.Model != "" {
+		filter.add("(requested_model = $%[1]d OR model = $%[1]d)", req.Model)
+	}
+	switch req.Status {
+	case "":
+	case models.RequestStatusSuccess:
+		filter.addRaw("status < 400")
+	case models.RequestStatusError:
+		filter.addRaw("status >= 400")
+	default:
+		return nil, invalidRequest("unknown status %q, expected %s or %s", req.Status, models.RequestStatusSuccess, models.RequestStatusError)
+	}
+	if !req.Since.IsZero() {
+		filter.add("created_at >= $%d", req.Since)
+	}
+	if !req.Until.IsZero() {
+		filter.add("created_at < $%d", req.Until)
+	}
+
+	// Fetch one more row than requested to know whether there is a next page
+	query := `SELECT ` + requestLogColumns + ` FROM request_log` + filter.where() +
+		` ORDER BY id DESC LIMIT ` + filter.placeholder(limit+1)
+
+	rows, err := l.db.Query(ctx, query, filter.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query request log: %v", err)
+	}
+	defer rows.Close()
+
+	response := &models.ListRequestsResponse{Requests: make([]*models.RequestLogEntry, 0, limit)}
+	for rows.Next() {
+		entry, err := scanRequestLogEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query request log: %v", err)
+		}
+		response.Requests = append(response.Requests, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query request log: %v", err)
+	}
+
+	if len(response.Requests) > limit {
+		response.Requests = response.Requests[:limit]
+		cursor := response.Requests[limit-1].ID
+		response.NextCursor = &cursor
+	}
+	return response, nil
+}
+
+// scanRequestLogEntry scans a row of requestLogColumns
+func scanRequestLogEntry(row rowScanner) (*models.RequestLogEntry, error) {
+	entry := &models.RequestLogEntry{}
+	var promptTokens, completionTokens, totalTokens *int
+	var parameters string
+	var requestBody, responseBody *string
+	err := row.Scan(
+		&entry.ID,
+		&entry.RequestID,
+		&entry.CreatedAt,
+		&entry.Endpoint,
+		&entry.APIKeyID,
+		&entry.APIKeyName,
+		&entry.Provider,
+		&entry.Model,
+		&entry.RequestedModel,
+		&entry.Stream,
+		&parameters,
+		&entry.Status,
+		&entry.Error,
+		&entry.FinishReason,
+		&entry.LatencyMs,
+		&promptTokens,
+		&completionTokens,
+		&totalTokens,
+		&entry.Cache,
+		&requestBody,
+		&responseBody,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Parameters = json.RawMessage(parameters)
+	if totalTokens != nil {
+		entry.Usage = &models.Usage{TotalTokens: *totalTokens}
+		if promptTokens != nil {
+			entry.Usage.PromptTokens = *promptTokens
+		}
+		if completionTokens != nil {
+			entry.Usage.CompletionTokens = *completionTokens
+		}
+	}
+	if requestBody != nil {
+		entry.RequestBody = json.RawMessage(*requestBody)
+	}
+	if responseBody != nil {
+		entry.ResponseBody = json.RawMessage(*responseBody)
+	}
+	return entry, nil
+}
+
+// requestParameters returns the request without its messages and prompt as a JSON object
+func requestParameters(req *models.ChatRequest) json.RawMessage {
+	params := *req
+	params.Messages = nil
+	params.Prompt = ""
+	return jsonParameters(&params, "messages", "prompt")
+}
+
+// jsonParameters returns a request as a JSON object without the omitted fields
+func jsonParameters(req interface{}, omit ...string) json.RawMessage {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return json.RawMessage("{}")
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return json.RawMessage("{}")
+	}
+	for _, name := range omit {
+		delete(fields, name)
+	}
+
+	data, _ = json.Marshal(fields)
+	return data
+}
+
+// nullableJSON returns data as a string for a JSONB column, nil for SQL NULL if empty
+func nullableJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	id := make([]byte, 12)
+	rand.Read(id)
+	return "req_" + hex.EncodeToString(id)
+}
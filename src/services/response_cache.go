@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"encore.dev/storage/cache"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// Response cache defaults
+const (
+	DefaultResponseCacheTTL = time.Hour
+	maxMemoryCacheEntries   = 10000 // Entries a MemoryResponseStore holds before evicting
+)
+
+// ResponseStore keeps cached chat responses by key
+type ResponseStore interface {
+	// Get returns the response stored under key, nil if there is none
+	Get(ctx context.Context, key string) (*models.ChatResponse, error)
+	// Set stores response under key for ttl
+	Set(ctx context.Context, key string, response *models.ChatResponse, ttl time.Duration) error
+}
+
+// EncoreResponseStore keeps responses in an Encore cache keyspace (Redis)
+type EncoreResponseStore struct {
+	keyspace *cache.StructKeyspace[string, models.ChatResponse]
+}
+
+// NewEncoreResponseStore creates a response store backed by keyspace
+func NewEncoreResponseStore(keyspace *cache.StructKeyspace[string, models.ChatResponse]) *EncoreResponseStore {
+	return &EncoreResponseStore{keyspace: keyspace}
+}
+
+// Get implements ResponseStore
+func (s *EncoreResponseStore) Get(ctx context.Context, key string) (*models.ChatResponse, error) {
+	response, err := s.keyspace.Get(ctx, key)
+	if errors.Is(err, cache.Miss) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Set implements ResponseStore
+func (s *EncoreResponseStore) Set(ctx context.Context, key string, response *models.ChatResponse, ttl time.Duration) error {
+	return s.keyspace.With(cache.ExpireIn(ttl)).Set(ctx, key, *response)
+}
+
+// memoryEntry is a response held by a MemoryResponseStore
+type memoryEntry struct {
+	data    []byte // JSON encoded, like in Redis, so callers never share a response
+	expires time.Time
+}
+
+// MemoryResponseStore keeps responses in process memory, for tests and single
+// instances without Redis
+type MemoryResponseStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+// NewMemoryResponseStore creates an empty in-memory response store
+func NewMemoryResponseStore() *MemoryResponseStore {
+	return &MemoryResponseStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get implements ResponseStore
+func (s *MemoryResponseStore) Get(ctx context.Context, key string) (*models.ChatResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil, nil
+	}
+	response := &models.ChatResponse{}
+	if err := json.Unmarshal(entry.data, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Set implements ResponseStore. A full store first drops expired entries,
+// then arbitrary ones.
+func (s *MemoryResponseStore) Set(ctx context.Context, key string, response *models.ChatResponse, ttl time.Duration) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.entries) >= maxMemoryCacheEntries {
+		for k, entry := range s.entries {
+			if now.After(entry.expires) {
+				delete(s.entries, k)
+			}
+		}
+		for k := range s.entries {
+			if len(s.entries) < maxMemoryCacheEntries {
+				break
+			}
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = memoryEntry{data: data, expires: now.Add(ttl)}
+	return nil
+}
+
+// ResponseCache serves repeated deterministic chat requests from a ResponseStore
+type ResponseCache struct {
+	store ResponseStore
+	ttl   time.Duration
+}
+
+// NewResponseCache creates a response cache over store, nil if the cache is disabled
+func NewResponseCache(cfg *config.Config, store ResponseStore) *ResponseCache {
+	if !cfg.ResponseCache.Enabled {
+		return nil
+	}
+	ttl := DefaultResponseCacheTTL
+	if cfg.ResponseCache.TTLSeconds > 0 {
+		ttl = time.Duration(cfg.ResponseCache.TTLSeconds) * time.Second
+	}
+	return &ResponseCache{store: store, ttl: ttl}
+}
+
+// key returns the cache key of a prepared request, or false if its response must
+// not be cached: the cache is disabled, the caller opted out, the request streams
+// or its temperature is not 0. Like semantic cache lookups, the key is scoped to
+// the caller's gateway key, so keys never see each other's responses.
+func (c *ResponseCache) key(ctx context.Context, req *models.ChatRequest, attempts []providerAttempt) (string, bool) {
+	if c == nil || req.Cache == models.CacheNoStore || (req.Stream != nil && *req.Stream) {
+		return "", false
+	}
+	if req.Temperature == nil || *req.Temperature != 0 {
+		return "", false
+	}
+
+	hash, err := requestHash(req, attempts)
+	if err != nil {
+		return "", false
+	}
+	if key := apiKeyFrom(ctx); key != nil {
+		return strconv.FormatInt(key.ID, 10) + ":" + hash, true
+	}
+	return hash, true
+}
+
+// requestHash returns a canonical hash of a prepared request as sent to the
+// providers, with the provider and model every attempt targets
+func requestHash(req *models.ChatRequest, attempts []providerAttempt) (string, error) {
+	canonical := struct {
+		Targets []string           `json:"targets"`
+		Request models.ChatRequest `json:"request"`
+	}{Request: *req}
+	for _, attempt := range attempts {
+		model := attempt.model
+		if model == "" {
+			model = providers.DefaultModel(attempt.provider)
+		}
+		canonical.Targets = append(canonical.Targets, attempt.provider.GetName()+"/"+model)
+	}
+	canonical.Request.Stream = nil
+	canonical.Request.Cache = ""
+	canonical.Request.Timeout = nil
+
+	data, err := json.Marshal(&canonical)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// get returns the response cached under key, nil on a miss. Store failures count as misses.
+func (c *ResponseCache) get(ctx context.Context, key string) *models.ChatResponse {
+	response, err := c.store.Get(ctx, key)
+	if err != nil {
+		log.Printf("[CACHE] Failed to read cached response: %v", err)
+		return nil
+	}
+	return response
+}
+
+// set caches response under key; failures are only logged
+func (c *ResponseCache) set(ctx context.Context, key string, response *models.ChatResponse) {
+	if err := c.store.Set(ctx, key, response, c.ttl); err != nil {
+		log.Printf("[CACHE] Failed to cache response: %v", err)
+	}
+}
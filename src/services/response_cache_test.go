@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+func TestResponseCacheKey(t *testing.T) {
+	c := NewResponseCache(&config.Config{ResponseCache: config.ResponseCacheConfig{Enabled: true}}, NewMemoryResponseStore())
+	groq := &fakeProvider{name: "groq", defaultModel: "llama-3.3-70b-versatile"}
+	gemini := &fakeProvider{name: "gemini", defaultModel: "gemini-2.5-flash"}
+	attempts := []providerAttempt{{provider: groq}}
+
+	zero, warm := 0.0, 0.7
+	stream, timeout := false, 30
+	request := func(edit func(req *models.ChatRequest)) *models.ChatRequest {
+		req := &models.ChatRequest{Prompt: "hi", Temperature: &zero}
+		if edit != nil {
+			edit(req)
+		}
+		return req
+	}
+	base, _ := c.key(context.Background(), request(nil), attempts)
+
+	tests := []struct {
+		name     string
+		key      *models.APIKey
+		req      *models.ChatRequest
+		attempts []providerAttempt
+		want     string // "same" or "different" from the key of the base request, "" if not cacheable
+	}{
+		{"same request", nil, request(nil), attempts, "same"},
+		{"stream, cache and timeout ignored", nil, request(func(req *models.ChatRequest) {
+			req.Stream, req.Cache, req.Timeout = &stream, models.CacheSemantic, &timeout
+		}), attempts, "same"},
+		{"default model spelled out", nil, request(nil), []providerAttempt{{provider: groq, model: "llama-3.3-70b-versatile"}}, "same"},
+		{"different prompt", nil, request(func(req *models.ChatRequest) { req.Prompt = "hello" }), attempts, "different"},
+		{"different target", nil, request(nil), []providerAttempt{{provider: gemini}}, "different"},
+		{"gateway key", &models.APIKey{ID: 1, Name: "a"}, request(nil), attempts, "different"},
+		{"not deterministic", nil, request(func(req *models.ChatRequest) { req.Temperature = &warm }), attempts, ""},
+		{"no-store", nil, request(func(req *models.ChatRequest) { req.Cache = models.CacheNoStore }), attempts, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.key != nil {
+				ctx = WithAPIKey(ctx, tt.key)
+			}
+
+			key, ok := c.key(ctx, tt.req, tt.attempts)
+			switch {
+			case tt.want == "":
+				if ok {
+					t.Fatalf("request is cacheable under %s, want not cacheable", key)
+				}
+			case !ok:
+				t.Fatalf("request is not cacheable")
+			case (key == base) != (tt.want == "same"):
+				t.Fatalf("key %s, want %s from %s", key, tt.want, base)
+			}
+		})
+	}
+}
+
+func TestResponseCacheKeyScopedToGatewayKey(t *testing.T) {
+	c := NewResponseCache(&config.Config{ResponseCache: config.ResponseCacheConfig{Enabled: true}}, NewMemoryResponseStore())
+	zero := 0.0
+	req := &models.ChatRequest{Prompt: "hi", Temperature: &zero}
+	attempts := []providerAttempt{{provider: &fakeProvider{name: "groq", defaultModel: "llama-3.3-70b-versatile"}}}
+
+	ctx := context.Background()
+	first, _ := c.key(WithAPIKey(ctx, &models.APIKey{ID: 1, Name: "a"}), req, attempts)
+	second, _ := c.key(WithAPIKey(ctx, &models.APIKey{ID: 2, Name: "b"}), req, attempts)
+	if first == second {
+		t.Fatalf("keys 1 and 2 share the cache key %s", first)
+	}
+	if !strings.HasPrefix(first, "1:") || !strings.HasPrefix(second, "2:") {
+		t.Fatalf("cache keys %s and %s are not prefixed with the key ID", first, second)
+	}
+
+	c.set(ctx, first, &models.ChatResponse{ID: "cached"})
+	if response := c.get(ctx, second); response != nil {
+		t.Fatalf("key 2 was served the response cached for key 1")
+	}
+}
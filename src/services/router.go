@@ -0,0 +1,138 @@
+package services
+
+import (
+	"log"
+
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// routeTarget is a provider and the model to request from it; an empty model means the provider default
+type routeTarget struct {
+	provider string
+	model    string
+}
+
+// routeRequest resolves the model and provider of a request into the ordered
+// list of targets to try.
+//
+// The model picks the provider by itself when it is a configured alias, is
+// prefixed with a provider ("gemini/gemini-2.5-pro") or appears in a provider's
+// model catalog. A provider (or list) given on the request restricts the
+// targets to those providers. Without a model the provider chain is used with
+// each provider's default model.
+func (cs *ChatService) routeRequest(req *models.ChatRequest) ([]routeTarget, error) {
+	if req.Model == "" {
+		return cs.chainTargets(cs.providerChain(req), ""), nil
+	}
+
+	// Aliases expand to an explicit chain of provider-prefixed models
+	if aliasTargets, ok := cs.config.ResolveAlias(req.Model); ok {
+		targets := make([]routeTarget, 0, len(aliasTargets))
+		for _, target := range aliasTargets {
+			provider, model, _ := cs.config.SplitModel(target)
+			targets = append(targets, routeTarget{provider: provider, model: model})
+		}
+		return restrictTargets(req, targets)
+	}
+
+	if provider, model, ok := cs.config.SplitModel(req.Model); ok {
+		return restrictTargets(req, []routeTarget{{provider: provider, model: model}})
+	}
+
+	// The caller named the provider, the model is passed through as is
+	if len(req.Provider) > 0 {
+		return cs.chainTargets(req.Provider, req.Model), nil
+	}
+
+	owner, err := cs.findModelOwner(req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back through the rest of the configured chain, skipping the owner
+	chain := []string{owner}
+	for _, name := range cs.config.Fallback.Providers {
+		if name != owner {
+			chain = append(chain, name)
+		}
+	}
+	return cs.chainTargets(chain, req.Model), nil
+}
+
+// providerChain returns the provider names to try, in order.
+// A provider (or list) given on the request wins over the configured chain.
+func (cs *ChatService) providerChain(req *models.ChatRequest) []string {
+	if len(req.Provider) > 0 {
+		return req.Provider
+	}
+	if len(cs.config.Fallback.Providers) > 0 {
+		return cs.config.Fallback.Providers
+	}
+	return []string{DefaultProvider}
+}
+
+// chainTargets builds the targets for a provider chain. The model is used on
+// the first provider; later providers use the configured model mapping or, if
+// there is none, their own default model.
+func (cs *ChatService) chainTargets(chain []string, model string) []routeTarget {
+	targets := make([]routeTarget, 0, len(chain))
+	for i, name := range chain {
+		target := routeTarget{provider: name, model: model}
+		if i > 0 && model != "" {
+			mapped, ok := cs.config.MapModel(model, name)
+			if !ok {
+				log.Printf("[CHAT] No model mapping for %s on %s, using provider default", model, name)
+			}
+			target.model = mapped
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// restrictTargets keeps the targets whose provider was named on the request, if any
+func restrictTargets(req *models.ChatRequest, targets []routeTarget) ([]routeTarget, error) {
+	if len(req.Provider) == 0 {
+		return targets, nil
+	}
+
+	allowed := make(map[string]bool, len(req.Provider))
+	for _, name := range req.Provider {
+		allowed[name] = true
+	}
+
+	restricted := make([]routeTarget, 0, len(targets))
+	for _, target := range targets {
+		if allowed[target.provider] {
+			restricted = append(restricted, target)
+		}
+	}
+	if len(restricted) == 0 {
+		return nil, invalidRequest("model %s is not served by provider %v", req.Model, []string(req.Provider))
+	}
+	return restricted, nil
+}
+
+// findModelOwner returns the provider whose static model catalog lists model.
+// Providers of the configured fallback chain are checked first, then all others
+// in order. Live model lists are not consulted, so the same model always routes
+// the same way whether or not a provider's list happens to be cached; models
+// only a live list reports are reached with a provider prefix.
+func (cs *ChatService) findModelOwner(model string) (string, error) {
+	names := append([]string{}, cs.config.Fallback.Providers...)
+	names = append(names, cs.config.GetSupportedProviders()...)
+
+	for _, name := range names {
+		catalog, err := providers.GetCatalog(name)
+		if err != nil {
+			continue
+		}
+		for _, info := range catalog {
+			if info.ID == model {
+				return name, nil
+			}
+		}
+	}
+	return "", invalidRequest("unknown model %q, use \"<provider>/<model>\" or a configured alias", model)
+}
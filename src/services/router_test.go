@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// registerProvider registers provider under name for the duration of the test
+func registerProvider(t *testing.T, name string, provider providers.Provider) {
+	t.Helper()
+	if _, err := providers.GetProvider(name); err == nil {
+		t.Fatalf("provider %s is already registered", name)
+	}
+	providers.RegisterProvider(name, provider)
+	t.Cleanup(func() { providers.UnregisterProvider(name) })
+}
+
+func TestRouteRequest(t *testing.T) {
+	cfg := &config.Config{
+		Fallback: config.FallbackConfig{
+			Providers: []string{"groq", "gemini"},
+			ModelMap:  map[string]map[string]string{"gemini-2.5-pro": {"groq": "llama-3.3-70b-versatile"}},
+		},
+		Router: config.RouterConfig{Aliases: map[string][]string{"fast": {"groq/llama-3.1-8b-instant", "gemini/gemini-2.5-flash"}}},
+	}
+	registerProvider(t, "groq", providers.NewGroqProvider(cfg))
+	registerProvider(t, "gemini", providers.NewGeminiProvider(cfg))
+
+	cs := &ChatService{config: cfg, models: newModelCache()}
+	// A model only the live list reports must not route while the list is cached
+	cs.models.set("groq", []providers.ModelInfo{{ID: "live-only-model"}}, time.Hour)
+
+	tests := []struct {
+		name     string
+		model    string
+		provider models.ProviderList
+		want     []string // "provider/model" of each target, nil if rejected
+	}{
+		{"fallback chain", "", nil, []string{"groq/", "gemini/"}},
+		{"provider without model", "", models.ProviderList{"gemini"}, []string{"gemini/"}},
+		{"alias", "fast", nil, []string{"groq/llama-3.1-8b-instant", "gemini/gemini-2.5-flash"}},
+		{"alias restricted to provider", "fast", models.ProviderList{"gemini"}, []string{"gemini/gemini-2.5-flash"}},
+		{"alias not served by provider", "fast", models.ProviderList{"atlas"}, nil},
+		{"prefixed model", "gemini/gemini-2.5-pro", nil, []string{"gemini/gemini-2.5-pro"}},
+		{"model passed through to named provider", "meta-llama/llama-3.3-70b-instruct", models.ProviderList{"openrouter"}, []string{"openrouter/meta-llama/llama-3.3-70b-instruct"}},
+		{"catalog model with mapping", "gemini-2.5-pro", nil, []string{"gemini/gemini-2.5-pro", "groq/llama-3.3-70b-versatile"}},
+		{"catalog model without mapping", "llama-3.1-8b-instant", nil, []string{"groq/llama-3.1-8b-instant", "gemini/"}},
+		{"live-only model", "live-only-model", nil, nil},
+		{"unknown model", "gpt-17", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := cs.routeRequest(&models.ChatRequest{Model: tt.model, Provider: tt.provider})
+			if tt.want == nil {
+				var apiErr *errs.Error
+				if !errors.As(err, &apiErr) || apiErr.Code != errs.InvalidArgument {
+					t.Fatalf("got %v, want an invalid argument error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := make([]string, 0, len(targets))
+			for _, target := range targets {
+				got = append(got, target.provider+"/"+target.model)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("got targets %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+// Semantic cache defaults
+const (
+	DefaultSemanticCacheThreshold  = 0.95
+	DefaultSemanticCacheTTL        = time.Hour
+	DefaultSemanticCacheMaxEntries = 10000
+)
+
+// semanticEntry is a cached response and the embedding of the question it answered
+type semanticEntry struct {
+	scope   string
+	vector  []float64 // Unit length
+	data    []byte    // JSON encoded response, so callers never share a response
+	expires time.Time
+}
+
+// vectorIndex is an in-process nearest neighbour index of unit vectors,
+// partitioned by scope. It evicts the oldest entries when full.
+type vectorIndex struct {
+	mu         sync.Mutex
+	scopes     map[string][]*semanticEntry
+	order      []*semanticEntry // Oldest first
+	maxEntries int
+}
+
+// newVectorIndex creates an empty index holding up to maxEntries entries
+func newVectorIndex(maxEntries int) *vectorIndex {
+	return &vectorIndex{
+		scopes:     make(map[string][]*semanticEntry),
+		maxEntries: maxEntries,
+	}
+}
+
+// nearest returns the live entry of scope most similar to vector and their
+// cosine similarity, nil if the scope has none
+func (x *vectorIndex) nearest(scope string, vector []float64, now time.Time) (*semanticEntry, float64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var best *semanticEntry
+	bestSimilarity := -1.0
+	for _, entry := range x.scopes[scope] {
+		if now.After(entry.expires) || len(entry.vector) != len(vector) {
+			continue
+		}
+		if similarity := dot(entry.vector, vector); similarity > bestSimilarity {
+			best, bestSimilarity = entry, similarity
+		}
+	}
+	return best, bestSimilarity
+}
+
+// add inserts entry, first dropping expired entries and then the oldest ones if the index is full
+func (x *vectorIndex) add(entry *semanticEntry, now time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if len(x.order) >= x.maxEntries {
+		for _, old := range slices.Clone(x.order) {
+			if now.After(old.expires) {
+				x.remove(old)
+			}
+		}
+		for len(x.order) >= x.maxEntries {
+			x.remove(x.order[0])
+		}
+	}
+	x.scopes[entry.scope] = append(x.scopes[entry.scope], entry)
+	x.order = append(x.order, entry)
+}
+
+// remove drops entry from the index; the caller holds the lock
+func (x *vectorIndex) remove(entry *semanticEntry) {
+	x.order = slices.DeleteFunc(x.order, func(e *semanticEntry) bool { return e == entry })
+	entries := slices.DeleteFunc(x.scopes[entry.scope], func(e *semanticEntry) bool { return e == entry })
+	if len(entries) == 0 {
+		delete(x.scopes, entry.scope)
+		return
+	}
+	x.scopes[entry.scope] = entries
+}
+
+// SemanticCache serves chat requests whose last user message is close enough to
+// an earlier question from the same key, model and conversation
+type SemanticCache struct {
+	index     *vectorIndex
+	model     string
+	threshold float64
+	ttl       time.Duration
+}
+
+// newSemanticCache creates the semantic cache, nil if it is disabled
+func newSemanticCache(cfg *config.Config) *SemanticCache {
+	settings := cfg.SemanticCache
+	if !settings.Enabled {
+		return nil
+	}
+
+	c := &SemanticCache{
+		model:     settings.Model,
+		threshold: DefaultSemanticCacheThreshold,
+		ttl:       DefaultSemanticCacheTTL,
+	}
+	if settings.Threshold > 0 {
+		c.threshold = settings.Threshold
+	}
+	if settings.TTLSeconds > 0 {
+		c.ttl = time.Duration(settings.TTLSeconds) * time.Second
+	}
+	maxEntries := DefaultSemanticCacheMaxEntries
+	if settings.MaxEntries > 0 {
+		maxEntries = settings.MaxEntries
+	}
+	c.index = newVectorIndex(maxEntries)
+	return c
+}
+
+// semanticQuery is the scope and question embedding of a request looked up in the semantic cache
+type semanticQuery struct {
+	scope  string
+	vector []float64
+}
+
+// find returns the cached response nearest to query and its similarity, nil if none reaches the threshold
+func (c *SemanticCache) find(query *semanticQuery) (*models.ChatResponse, float64) {
+	entry, similarity := c.index.nearest(query.scope, query.vector, time.Now())
+	if entry == nil || similarity < c.threshold {
+		return nil, similarity
+	}
+
+	response := &models.ChatResponse{}
+	if err := json.Unmarshal(entry.data, response); err != nil {
+		log.Printf("[CACHE] Failed to decode semantically cached response: %v", err)
+		return nil, similarity
+	}
+	return response, similarity
+}
+
+// add caches response as the answer to query
+func (c *SemanticCache) add(query *semanticQuery, response *models.ChatResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("[CACHE] Failed to cache response semantically: %v", err)
+		return
+	}
+
+	now := time.Now()
+	c.index.add(&semanticEntry{
+		scope:   query.scope,
+		vector:  query.vector,
+		data:    data,
+		expires: now.Add(c.ttl),
+	}, now)
+}
+
+// semanticQuery embeds the last user message of a prepared request that opted
+// into the semantic cache. The scope is the caller's key and the rest of the
+// request, so only the question may differ between a hit and the cached request.
+// Returns nil if the request did not opt in or the question could not be embedded.
+func (cs *ChatService) semanticQuery(ctx context.Context, req *models.ChatRequest, attempts []providerAttempt) *semanticQuery {
+	if cs.semantic == nil || req.Cache != models.CacheSemantic || (req.Stream != nil && *req.Stream) {
+		return nil
+	}
+
+	last := -1
+	for i := range req.Messages {
+		if req.Messages[i].Role == "user" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return nil
+	}
+	question := req.Messages[last].Text()
+	if strings.TrimSpace(question) == "" {
+		return nil
+	}
+
+	rest := *req
+	rest.Messages = slices.Delete(slices.Clone(req.Messages), last, last+1)
+	rest.Prompt = ""
+	hash, err := requestHash(&rest, attempts)
+	if err != nil {
+		return nil
+	}
+	scope := hash
+	if key := apiKeyFrom(ctx); key != nil {
+		scope = strconv.FormatInt(key.ID, 10) + ":" + hash
+	}
+
+	vector, err := cs.embedQuestion(ctx, question)
+	if err != nil {
+		log.Printf("[CACHE] Failed to embed question for the semantic cache: %v", err)
+		return nil
+	}
+	return &semanticQuery{scope: scope, vector: vector}
+}
+
+// embedQuestion returns the unit length embedding of text with the semantic
+// cache's model. The caller's key restrictions do not apply to this internal
+// call, but it is charged to the key's budget and usage.
+func (cs *ChatService) embedQuestion(ctx context.Context, text string) ([]float64, error) {
+	req := &models.EmbeddingRequest{
+		Input: models.EmbeddingInput{text},
+		Model: cs.semantic.model,
+	}
+	attempts, err := cs.embeddingAttempts(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lookup holds its own budget, released once the ledger has recorded it
+	lookupCtx := cs.budgets.Reserve(ctx)
+	defer cs.budgets.Release(lookupCtx)
+	response, err := cs.embed(lookupCtx, req, attempts[:1])
+	if err != nil {
+		return nil, err
+	}
+	cs.usage.recordEmbeddings(ctx, response, estimateTextTokens(utf8.RuneCountInString(text)))
+
+	if len(response.Data) == 0 {
+		return nil, fmt.Errorf("provider %s returned no embedding", response.Provider)
+	}
+	vector, ok := response.Data[0].Embedding.([]float64)
+	if !ok || len(vector) == 0 {
+		return nil, fmt.Errorf("provider %s returned an empty embedding", response.Provider)
+	}
+	return normalize(vector), nil
+}
+
+// normalize returns vector scaled to unit length, so that cosine similarity is a dot product
+func normalize(vector []float64) []float64 {
+	norm := math.Sqrt(dot(vector, vector))
+	if norm == 0 {
+		return vector
+	}
+	unit := make([]float64, len(vector))
+	for i, v := range vector {
+		unit[i] = v / norm
+	}
+	return unit
+}
+
+// dot returns the dot product of two vectors of equal length
+func dot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
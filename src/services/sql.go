@@ -0,0 +1,43 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rowScanner is a single query result row, *sqldb.Row or *sqldb.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlFilter builds a WHERE clause with numbered placeholders
+type sqlFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// add adds a condition on value; the condition refers to its placeholder as %d,
+// or %[1]d if it needs it more than once
+func (f *sqlFilter) add(condition string, value interface{}) {
+	f.args = append(f.args, value)
+	f.conditions = append(f.conditions, fmt.Sprintf(condition, len(f.args)))
+}
+
+// addRaw adds a condition without a value
+func (f *sqlFilter) addRaw(condition string) {
+	f.conditions = append(f.conditions, condition)
+}
+
+// placeholder adds a value that is not part of a condition, e.g. a LIMIT, and returns its placeholder
+func (f *sqlFilter) placeholder(value interface{}) string {
+	f.args = append(f.args, value)
+	return fmt.Sprintf("$%d", len(f.args))
+}
+
+// where returns the WHERE clause, empty if there are no conditions
+func (f *sqlFilter) where() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"encore.app/src/models"
+	"encore.app/src/providers"
+	"encore.app/src/utils"
+)
+
+// MaxOutputValidationRetries is how often a provider is asked again when its output does not match the response format
+const MaxOutputValidationRetries = 1
+
+// OutputValidationError is returned when a response does not match the requested response format
+type OutputValidationError struct {
+	Provider string
+	Format   string // json_object or json_schema
+	Reason   string
+}
+
+// Error implements the error interface
+func (e *OutputValidationError) Error() string {
+	return fmt.Sprintf("provider %s returned output that does not match response_format %s: %s", e.Provider, e.Format, e.Reason)
+}
+
+// validateResponseFormatRequest checks the response_format of a request
+func validateResponseFormatRequest(format *models.ResponseFormat) error {
+	if format == nil {
+		return nil
+	}
+
+	switch format.Type {
+	case models.ResponseFormatText, models.ResponseFormatJSONObject:
+		return nil
+	case models.ResponseFormatJSONSchema:
+		if format.JSONSchema == nil || len(format.JSONSchema.Schema) == 0 {
+			return invalidRequest("response_format json_schema requires json_schema.schema")
+		}
+		var schema map[string]interface{}
+		if err := json.Unmarshal(format.JSONSchema.Schema, &schema); err != nil {
+			return invalidRequest("response_format schema must be a JSON object")
+		}
+		if err := utils.CheckJSONSchema(format.JSONSchema.Schema); err != nil {
+			return invalidRequest("response_format schema: %v", err)
+		}
+		return nil
+	default:
+		return invalidRequest("unknown response_format type %q", format.Type)
+	}
+}
+
+// checkOutput validates the text of a choice against the requested response format
+func checkOutput(provider string, format *models.ResponseFormat, text string) error {
+	if format == nil || format.Type == models.ResponseFormatText {
+		return nil
+	}
+
+	var err error
+	text = strings.TrimSpace(text)
+	if format.Type == models.ResponseFormatJSONSchema {
+		err = utils.ValidateJSONSchema(format.JSONSchema.Schema, []byte(text))
+	} else {
+		var object map[string]interface{}
+		if jsonErr := json.Unmarshal([]byte(text), &object); jsonErr != nil {
+			err = fmt.Errorf("not a JSON object: %v", jsonErr)
+		}
+	}
+
+	if err != nil {
+		return &OutputValidationError{Provider: provider, Format: format.Type, Reason: err.Error()}
+	}
+	return nil
+}
+
+// checkResponseOutput validates every choice of a response that ended with text rather than tool calls
+func checkResponseOutput(provider string, format *models.ResponseFormat, response *models.ChatResponse) error {
+	for _, choice := range response.Choices {
+		if choice.FinishReason == "tool_calls" {
+			continue
+		}
+		if err := checkOutput(provider, format, choice.Message.Text()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callProvider calls the attempt's provider, asking again up to MaxOutputValidationRetries
+// times when the output does not match the requested response format. Every try is
+// billed, so the usage of all of them is returned, also on failure, and is the usage
+// of the returned response.
+func (cs *ChatService) callProvider(ctx context.Context, attempt providerAttempt, req *models.ChatRequest) (*models.ChatResponse, models.Usage, error) {
+	name := attempt.provider.GetName()
+	var usage models.Usage
+	for try := 0; ; try++ {
+		response, err := attempt.provider.ChatCompletion(ctx, attempt.request(req), attempt.apiKey)
+		if err != nil {
+			return nil, usage, err
+		}
+		usage.PromptTokens += response.Usage.PromptTokens
+		usage.CompletionTokens += response.Usage.CompletionTokens
+		usage.TotalTokens += response.Usage.TotalTokens
+
+		err = checkResponseOutput(name, req.ResponseFormat, response)
+		if err == nil {
+			response.Usage = usage
+			return response, usage, nil
+		}
+		if try >= MaxOutputValidationRetries || ctx.Err() != nil {
+			return nil, usage, err
+		}
+		log.Printf("[CHAT] Retrying provider %s: %v", name, err)
+	}
+}
+
+// outputValidator accumulates the streamed text of every choice to validate it once the choice finishes
+type outputValidator struct {
+	provider string
+	format   *models.ResponseFormat
+	text     map[int]*strings.Builder
+	calls    map[int]bool
+}
+
+// newOutputValidator creates a validator for a stream, or nil if no structured output was requested
+func newOutputValidator(provider string, format *models.ResponseFormat) *outputValidator {
+	if format == nil || format.Type == models.ResponseFormatText {
+		return nil
+	}
+	return &outputValidator{
+		provider: provider,
+		format:   format,
+		text:     make(map[int]*strings.Builder),
+		calls:    make(map[int]bool),
+	}
+}
+
+// add records a chunk and validates the choices it finishes
+func (v *outputValidator) add(chunk *models.ChatCompletionChunk) error {
+	for _, choice := range chunk.Choices {
+		text, ok := v.text[choice.Index]
+		if !ok {
+			text = &strings.Builder{}
+			v.text[choice.Index] = text
+		}
+		text.WriteString(choice.Delta.Content)
+		if len(choice.Delta.ToolCalls) > 0 {
+			v.calls[choice.Index] = true
+		}
+
+		if choice.FinishReason != nil && !v.calls[choice.Index] {
+			if err := checkOutput(v.provider, v.format, text.String()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wrap returns a chunk handler that validates every chunk before passing it to onChunk.
+// A choice is validated when it finishes, so the error follows its last chunk.
+func (v *outputValidator) wrap(onChunk providers.ChunkHandler) providers.ChunkHandler {
+	if v == nil {
+		return onChunk
+	}
+	return func(chunk *models.ChatCompletionChunk) error {
+		if err := onChunk(chunk); err != nil {
+			return err
+		}
+		return v.add(chunk)
+	}
+}
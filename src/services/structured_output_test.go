@@ -0,0 +1,201 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"encore.dev/beta/errs"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+)
+
+func TestValidateResponseFormatRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string // Chat request as sent by the client
+		wantErr bool
+	}{
+		{"none", `{"prompt": "hi"}`, false},
+		{"text", `{"response_format": {"type": "text"}}`, false},
+		{"json object", `{"response_format": {"type": "json_object"}}`, false},
+		{"json schema", `{"response_format": {"type": "json_schema", "json_schema": {"name": "a", "schema": {"type": "object", "properties": {"n": {"type": "integer"}}}}}}`, false},
+		{"json schema without schema", `{"response_format": {"type": "json_schema", "json_schema": {"name": "a"}}}`, true},
+		{"schema not an object", `{"response_format": {"type": "json_schema", "json_schema": {"name": "a", "schema": [1]}}}`, true},
+		{"cyclic schema", `{"response_format": {"type": "json_schema", "json_schema": {"name": "a", "schema": {"$defs": {"a": {"$ref": "#/$defs/a"}}, "$ref": "#/$defs/a"}}}}`, true},
+		{"unknown type", `{"response_format": {"type": "yaml"}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req models.ChatRequest
+			if err := json.Unmarshal([]byte(tt.input), &req); err != nil {
+				t.Fatalf("decoding failed: %v", err)
+			}
+
+			err := validateResponseFormatRequest(req.ResponseFormat)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var apiErr *errs.Error
+			if !errors.As(err, &apiErr) || apiErr.Code != errs.InvalidArgument {
+				t.Fatalf("got %v, want an invalid argument error", err)
+			}
+		})
+	}
+}
+
+func TestCheckResponseOutput(t *testing.T) {
+	object := &models.ResponseFormat{Type: models.ResponseFormatJSONObject}
+	schema := &models.ResponseFormat{Type: models.ResponseFormatJSONSchema, JSONSchema: &models.JSONSchemaFormat{
+		Name:   "answer",
+		Schema: json.RawMessage(`{"type": "object", "properties": {"n": {"type": "integer"}}, "required": ["n"]}`),
+	}}
+
+	tests := []struct {
+		name    string
+		format  *models.ResponseFormat
+		texts   []string // Text of each choice
+		reasons []string // Finish reason of each choice, "stop" if absent
+		wantErr bool
+	}{
+		{"no format", nil, []string{"plain text"}, nil, false},
+		{"text format", &models.ResponseFormat{Type: models.ResponseFormatText}, []string{"plain text"}, nil, false},
+		{"json object", object, []string{`{"a": 1}`}, nil, false},
+		{"json object in whitespace", object, []string{"\n {\"a\": 1}\n"}, nil, false},
+		{"json array is not an object", object, []string{`[1]`}, nil, true},
+		{"not json", object, []string{"sure, here it is"}, nil, true},
+		{"matches schema", schema, []string{`{"n": 3}`}, nil, false},
+		{"violates schema", schema, []string{`{"n": "three"}`}, nil, true},
+		{"second choice invalid", schema, []string{`{"n": 3}`, `{}`}, nil, true},
+		{"tool calls are not checked", schema, []string{""}, []string{"tool_calls"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := &models.ChatResponse{}
+			for i, text := range tt.texts {
+				reason := "stop"
+				if i < len(tt.reasons) {
+					reason = tt.reasons[i]
+				}
+				response.Choices = append(response.Choices, models.Choice{
+					Index:        i,
+					Message:      models.ChatMessage{Role: "assistant", Content: []models.ContentPart{{Type: "text", Text: text}}},
+					FinishReason: reason,
+				})
+			}
+
+			err := checkResponseOutput("test", tt.format, response)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var validationErr *OutputValidationError
+			if !errors.As(err, &validationErr) || validationErr.Format != tt.format.Type {
+				t.Fatalf("got %v, want an OutputValidationError for %s", err, tt.format.Type)
+			}
+		})
+	}
+}
+
+// scriptedProvider answers each call with the next of its replies, each billed at tokens
+type scriptedProvider struct {
+	fakeProvider
+	replies []string
+	tokens  int
+	calls   int
+}
+
+func (p *scriptedProvider) ChatCompletion(ctx context.Context, req *models.ChatRequest, apiKey string) (*models.ChatResponse, error) {
+	reply := p.replies[min(p.calls, len(p.replies)-1)]
+	p.calls++
+	return &models.ChatResponse{
+		Model: p.defaultModel + "-001", // Providers may report a more specific model
+		Choices: []models.Choice{{
+			Message:      models.ChatMessage{Role: "assistant", Content: []models.ContentPart{{Type: "text", Text: reply}}},
+			FinishReason: "stop",
+		}},
+		Usage: models.Usage{PromptTokens: p.tokens / 2, CompletionTokens: p.tokens - p.tokens/2, TotalTokens: p.tokens},
+	}, nil
+}
+
+func TestStructuredOutputRetriesAreMetered(t *testing.T) {
+	provider := &scriptedProvider{fakeProvider: fakeProvider{name: "scripted", defaultModel: "model-1"}, tokens: 40}
+	registerProvider(t, "scripted", provider)
+
+	limit := 10000
+	cfg := &config.Config{
+		CustomProviders: []config.CustomProvider{{Name: "scripted", AuthScheme: config.AuthSchemeNone}},
+		RateLimits: config.RateLimitConfig{
+			Key:       config.RateLimit{TokensPerMinute: limit},
+			Providers: map[string]config.RateLimit{"scripted": {TokensPerMinute: limit}},
+		},
+	}
+	cs := &ChatService{config: cfg, prices: NewModelPrices(cfg), limiter: NewRateLimiter()}
+
+	tests := []struct {
+		name      string
+		replies   []string
+		wantErr   bool
+		wantCalls int
+		wantUsed  int // Tokens charged to the key and the provider, and reported by a response
+	}{
+		{"valid at once", []string{`{"ok": true}`}, false, 1, 40},
+		{"valid on retry", []string{"not json", `{"ok": true}`}, false, 2, 80},
+		{"invalid twice", []string{"not json", "still not json"}, true, 2, 80},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider.replies, provider.calls = tt.replies, 0
+			cs.limiter = NewRateLimiter()
+			key := &models.APIKey{ID: int64(i + 1), Name: "test"}
+			req := &models.ChatRequest{
+				Prompt:         "answer in JSON",
+				Provider:       models.ProviderList{"scripted"},
+				ResponseFormat: &models.ResponseFormat{Type: models.ResponseFormatJSONObject},
+			}
+
+			ctx, _, err := cs.CheckRateLimit(WithAPIKey(context.Background(), key), req)
+			if err != nil {
+				t.Fatalf("CheckRateLimit failed: %v", err)
+			}
+			response, err := cs.ProcessChatCompletion(ctx, req)
+			if tt.wantErr {
+				var validationErr *OutputValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("got %v, want an OutputValidationError", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if response.Usage.TotalTokens != tt.wantUsed {
+					t.Errorf("response reports %d tokens, want %d", response.Usage.TotalTokens, tt.wantUsed)
+				}
+				// Priced like budget admission, by the requested model
+				if response.PricedModel != "model-1" {
+					t.Errorf("response priced by %q, want model-1", response.PricedModel)
+				}
+			}
+
+			if provider.calls != tt.wantCalls {
+				t.Errorf("%d upstream calls, want %d", provider.calls, tt.wantCalls)
+			}
+			for _, bucket := range []string{"key:" + strconv.FormatInt(key.ID, 10), "provider:scripted"} {
+				if got := limit - cs.limiter.buckets[bucket].status().RemainingTokens; got != tt.wantUsed {
+					t.Errorf("%d tokens charged to %s, want %d", got, bucket, tt.wantUsed)
+				}
+			}
+		})
+	}
+}
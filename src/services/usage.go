@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"encore.dev/storage/sqldb"
+
+	"encore.app/src/config"
+	"encore.app/src/models"
+	"encore.app/src/providers"
+)
+
+// usageDimension is a dimension usage reports can be grouped by
+type usageDimension struct {
+	name    string
+	columns []string                                 // Grouped columns
+	fields  func(row *models.UsageRow) []interface{} // Scan destinations of the columns
+}
+
+// usageDimensions are the usage report dimensions, in report order
+var usageDimensions = []usageDimension{
+	{
+		name:    models.UsageByDay,
+		columns: []string{`to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD')`},
+		fields:  func(row *models.UsageRow) []interface{} { return []interface{}{&row.Day} },
+	},
+	{
+		name:    models.UsageByKey,
+		columns: []string{`api_key_id`, `api_key_name`},
+		fields:  func(row *models.UsageRow) []interface{} { return []interface{}{&row.APIKeyID, &row.APIKeyName} },
+	},
+	{
+		name:    models.UsageByProvider,
+		columns: []string{`provider`},
+		fields:  func(row *models.UsageRow) []interface{} { return []interface{}{&row.Provider} },
+	},
+	{
+		name:    models.UsageByModel,
+		columns: []string{`model`},
+		fields:  func(row *models.UsageRow) []interface{} { return []interface{}{&row.Model} },
+	},
+}
+
+// UsageLedger records the token usage and cost of every served request
+type UsageLedger struct {
+	db    *sqldb.Database
+	price func(provider, model string) *providers.Pricing
+}
+
+// NewUsageLedger creates a new usage ledger writing to db, pricing models with
+// price, e.g. ModelPrices.Price
+func NewUsageLedger(db *sqldb.Database, price func(provider, model string) *providers.Pricing) *UsageLedger {
+	return &UsageLedger{db: db, price: price}
+}
+
+// Record adds the usage of a finished request to the ledger, priced at the
+// current price of the model requested from the provider, like budget admission
+// does, not the one the provider reports. A request whose provider reported no usage is
+// recorded with its estimated usage; requests no provider served are skipped.
+// Failures are only logged.
+func (u *UsageLedger) Record(ctx context.Context, entry *models.RequestLogEntry) {
+	usage := entry.Usage
+	if usage == nil {
+		usage = entry.UsageEstimate
+	}
+	if usage == nil || entry.Provider == "" {
+		return
+	}
+
+	model := entry.PricedModel
+	if model == "" {
+		model = entry.Model
+	}
+
+	var inputPrice, outputPrice, cost *float64
+	if price := u.price(entry.Provider, model); price != nil {
+		total := usageCost(usage, price)
+		inputPrice, outputPrice, cost = &price.Input, &price.Output, &total
+	}
+
+	_, err := u.db.Exec(context.WithoutCancel(ctx), `
+		INSERT INTO usage_ledger (request_id, api_key_id, api_key_name, provider, model,
+			prompt_tokens, completion_tokens, input_price, output_price, cost_usd)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		entry.RequestID, entry.APIKeyID, entry.APIKeyName, entry.Provider, model,
+		usage.PromptTokens, usage.CompletionTokens, inputPrice, outputPrice, cost)
+	if err != nil {
+		log.Printf("[USAGE] Failed to record usage of request %s: %v", entry.RequestID, err)
+	}
+}
+
+// recordEmbeddings adds the usage of an embeddings call the gateway made itself
+// while serving the request of ctx, charged to the request's gateway key
+func (u *UsageLedger) recordEmbeddings(ctx context.Context, response *models.EmbeddingResponse, estimate int) {
+	if u == nil {
+		return
+	}
+
+	entry := u.requestEntry(ctx, response.Provider, response.PricedModel)
+	setEmbeddingUsage(entry, response, estimate)
+	u.Record(ctx, entry)
+}
+
+// recordDiscarded adds the usage of provider responses that were billed but
+// discarded while serving the request of ctx, charged to the request's gateway key
+func (u *UsageLedger) recordDiscarded(ctx context.Context, provider, model string, usage *models.Usage) {
+	if u == nil || usage.TotalTokens == 0 {
+		return
+	}
+
+	entry := u.requestEntry(ctx, provider, model)
+	entry.Usage = usage
+	u.Record(ctx, entry)
+}
+
+// requestEntry returns a ledger entry for a call made while serving the request of ctx
+func (u *UsageLedger) requestEntry(ctx context.Context, provider, model string) *models.RequestLogEntry {
+	entry := &models.RequestLogEntry{
+		RequestID: requestIDFrom(ctx),
+		Provider:  provider,
+		Model:     model,
+	}
+	if key := apiKeyFrom(ctx); key != nil {
+		entry.APIKeyName = key.Name
+		if key.ID != 0 {
+			entry.APIKeyID = &key.ID
+		}
+	}
+	return entry
+}
+
+// setEmbeddingUsage sets the usage of an embeddings response on entry, or the
+// estimate if the provider reported none
+func setEmbeddingUsage(entry *models.RequestLogEntry, response *models.EmbeddingResponse, estimate int) {
+	if response.Usage.PromptTokens > 0 {
+		entry.Usage = &models.Usage{PromptTokens: response.Usage.PromptTokens, TotalTokens: response.Usage.TotalTokens}
+		return
+	}
+	entry.UsageEstimate = &models.Usage{PromptTokens: estimate, TotalTokens: estimate}
+}
+
+// Report aggregates the ledger by the requested dimensions
+func (u *UsageLedger) Report(ctx context.Context, req *models.UsageRequest) (*models.UsageReport, error) {
+	groupBy, err := parseUsageGroupBy(req.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &sqlFilter{}
+	if req.KeyID > 0 {
+		filter.add("api_key_id = $%d", req.KeyID)
+	}
+	if req.Provider != "" {
+		filter.add("provider = $%d", req.Provider)
+	}
+	if req.Model != "" {
+		filter.add("model = $%d", req.Model)
+	}
+	if !req.Since.IsZero() {
+		filter.add("created_at >= $%d", req.Since)
+	}
+	if !req.Until.IsZero() {
+		filter.add("created_at < $%d", req.Until)
+	}
+
+	var columns []string
+	for _, dimension := range groupBy {
+		columns = append(columns, dimension.columns...)
+	}
+
+	query := `SELECT `
+	for _, column := range columns {
+		query += column + `, `
+	}
+	query += `COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+		COALESCE(SUM(cost_usd), 0)::float8, COUNT(*) FILTER (WHERE cost_usd IS NULL)
+		FROM usage_ledger` + filter.where()
+	if len(columns) > 0 {
+		positions := make([]string, len(columns))
+		for i := range columns {
+			positions[i] = fmt.Sprint(i + 1)
+		}
+		query += ` GROUP BY ` + strings.Join(positions, ", ") + ` ORDER BY ` + strings.Join(positions, ", ")
+	}
+
+	rows, err := u.db.Query(ctx, query, filter.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %v", err)
+	}
+	defer rows.Close()
+
+	report := &models.UsageReport{Rows: make([]models.UsageRow, 0)}
+	for rows.Next() {
+		row := models.UsageRow{}
+		var dest []interface{}
+		for _, dimension := range groupBy {
+			dest = append(dest, dimension.fields(&row)...)
+		}
+		dest = append(dest, &row.Requests, &row.PromptTokens, &row.CompletionTokens, &row.CostUSD, &row.UnpricedRequests)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to query usage: %v", err)
+		}
+		row.TotalTokens = row.PromptTokens + row.CompletionTokens
+		if row.Requests == 0 {
+			continue // Aggregate over no rows without grouping
+		}
+
+		report.Rows = append(report.Rows, row)
+		report.Total.Requests += row.Requests
+		report.Total.PromptTokens += row.PromptTokens
+		report.Total.CompletionTokens += row.CompletionTokens
+		report.Total.TotalTokens += row.TotalTokens
+		report.Total.CostUSD += row.CostUSD
+		report.Total.UnpricedRequests += row.UnpricedRequests
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query usage: %v", err)
+	}
+	return report, nil
+}
+
+// parseUsageGroupBy parses a comma-separated list of usage dimensions into
+// report order, defaulting to all of them
+func parseUsageGroupBy(groupBy string) ([]usageDimension, error) {
+	if groupBy == "" {
+		return usageDimensions, nil
+	}
+
+	names := strings.Split(groupBy, ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		if !slices.ContainsFunc(usageDimensions, func(dimension usageDimension) bool { return dimension.name == names[i] }) {
+			return nil, invalidRequest("unknown group_by dimension %q, expected day, key, provider or model", names[i])
+		}
+	}
+
+	var dimensions []usageDimension
+	for _, dimension := range usageDimensions {
+		if slices.Contains(names, dimension.name) {
+			dimensions = append(dimensions, dimension)
+		}
+	}
+	return dimensions, nil
+}
+
+// ModelPrices prices models for budget admission and the usage ledger alike
+type ModelPrices struct {
+	config *config.Config
+	models *modelCache // Merged model lists, also served by ChatService.ListModels
+}
+
+// NewModelPrices creates the model prices of cfg
+func NewModelPrices(cfg *config.Config) *ModelPrices {
+	return &ModelPrices{config: cfg, models: newModelCache()}
+}
+
+// Price returns the price of a model: the configured override, or the
+// provider's model catalog. Returns nil if the price is unknown.
+func (p *ModelPrices) Price(provider, model string) *providers.Pricing {
+	if price, ok := p.config.Pricing[provider+"/"+model]; ok {
+		return &providers.Pricing{Input: price.Input, Output: price.Output}
+	}
+	for _, info := range p.knownModels(provider) {
+		if info.ID == model {
+			return info.Pricing
+		}
+	}
+	return nil
+}
+
+// knownModels returns the cached model list of a provider, or its static catalog
+func (p *ModelPrices) knownModels(name string) []providers.ModelInfo {
+	if cached, ok := p.models.get(name); ok {
+		return cached
+	}
+	catalog, err := providers.GetCatalog(name)
+	if err != nil {
+		return nil
+	}
+	return catalog
+}
+
+// usageCost returns the cost in USD of usage at price
+func usageCost(usage *models.Usage, price *providers.Pricing) float64 {
+	return (float64(usage.PromptTokens)*price.Input + float64(usage.CompletionTokens)*price.Output) / 1e6
+}
@@ -0,0 +1,410 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateJSONSchema checks that the JSON document data conforms to schema.
+// It supports the subset of JSON Schema used for structured output: type, enum,
+// const, properties, required, additionalProperties, items, anyOf, allOf, oneOf,
+// length, count and range limits, pattern and local $ref into $defs/definitions.
+// Other keywords are ignored.
+func ValidateJSONSchema(schema, data []byte) error {
+	var root interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return fmt.Errorf("invalid schema: %v", err)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	return validateSchema(root, root, value, "$", nil)
+}
+
+// CheckJSONSchema checks that every $ref in schema resolves and that no chain of
+// references leads back to itself without descending into a property or item,
+// which would make validation loop forever
+func CheckJSONSchema(schema []byte) error {
+	var root interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return fmt.Errorf("invalid schema: %v", err)
+	}
+
+	refs := make(map[string]bool)
+	collectRefs(root, refs)
+	for ref := range refs {
+		if _, err := resolveRef(root, ref); err != nil {
+			return err
+		}
+	}
+
+	// Depth-first search over references applied to the same value
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(ref string) error
+	visit = func(ref string) error {
+		switch state[ref] {
+		case visiting:
+			return fmt.Errorf("cyclic schema reference %q", ref)
+		case done:
+			return nil
+		}
+		state[ref] = visiting
+		resolved, _ := resolveRef(root, ref)
+		for _, next := range sameValueRefs(resolved) {
+			if err := visit(next); err != nil {
+				return err
+			}
+		}
+		state[ref] = done
+		return nil
+	}
+
+	sorted := make([]string, 0, len(refs))
+	for ref := range refs {
+		sorted = append(sorted, ref)
+	}
+	sort.Strings(sorted)
+	for _, ref := range sorted {
+		if err := visit(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectRefs adds every $ref string found in node to refs
+func collectRefs(node interface{}, refs map[string]bool) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			refs[ref] = true
+		}
+		for _, child := range n {
+			collectRefs(child, refs)
+		}
+	case []interface{}:
+		for _, child := range n {
+			collectRefs(child, refs)
+		}
+	}
+}
+
+// sameValueRefs returns the references schema applies to the value it validates
+// itself: its own $ref and those of its allOf, anyOf and oneOf subschemas
+func sameValueRefs(schema interface{}) []string {
+	object, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	var refs []string
+	if ref, ok := object["$ref"].(string); ok {
+		refs = append(refs, ref)
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if subschemas, ok := object[keyword].([]interface{}); ok {
+			for _, sub := range subschemas {
+				refs = append(refs, sameValueRefs(sub)...)
+			}
+		}
+	}
+	return refs
+}
+
+// validateSchema validates value at path against schema, resolving references from
+// root. refs are the references already followed for this value; following one of
+// them again would never terminate.
+func validateSchema(root, schema, value interface{}, path string, refs []string) error {
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			return fmt.Errorf("%s: not allowed", path)
+		}
+		return nil
+	case map[string]interface{}:
+		return validateObjectSchema(root, s, value, path, refs)
+	default:
+		return fmt.Errorf("invalid schema at %s", path)
+	}
+}
+
+// validateObjectSchema validates value at path against a schema object
+func validateObjectSchema(root interface{}, schema map[string]interface{}, value interface{}, path string, refs []string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		for _, followed := range refs {
+			if followed == ref {
+				return fmt.Errorf("cyclic schema reference %q", ref)
+			}
+		}
+		resolved, err := resolveRef(root, ref)
+		if err != nil {
+			return err
+		}
+		if err := validateSchema(root, resolved, value, path, append(refs[:len(refs):len(refs)], ref)); err != nil {
+			return err
+		}
+	}
+
+	if t, ok := schema["type"]; ok {
+		if err := checkType(t, value, path); err != nil {
+			return err
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value is not one of the allowed values", path)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		return fmt.Errorf("%s: value does not match the constant", path)
+	}
+
+	if err := validateCombinators(root, schema, value, path, refs); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(root, schema, v, path)
+	case []interface{}:
+		return validateArray(root, schema, v, path)
+	case string:
+		return validateString(schema, v, path)
+	case float64:
+		return validateNumber(schema, v, path)
+	}
+	return nil
+}
+
+// validateCombinators applies allOf, anyOf and oneOf
+func validateCombinators(root interface{}, schema map[string]interface{}, value interface{}, path string, refs []string) error {
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if err := validateSchema(root, sub, value, path, refs); err != nil {
+				return err
+			}
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if validateSchema(root, sub, value, path, refs) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: value matches none of anyOf", path)
+		}
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if validateSchema(root, sub, value, path, refs) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: value matches %d of oneOf, expected exactly 1", path, matches)
+		}
+	}
+	return nil
+}
+
+// validateObject applies properties, required and additionalProperties
+func validateObject(root interface{}, schema map[string]interface{}, object map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := object[key]; !present {
+					return fmt.Errorf("%s: missing required property %q", path, key)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	additional, hasAdditional := schema["additionalProperties"]
+
+	// Sorted for deterministic error messages
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propertyPath := path + "." + key
+		if propertySchema, ok := properties[key]; ok {
+			if err := validateSchema(root, propertySchema, object[key], propertyPath, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if hasAdditional {
+			if err := validateSchema(root, additional, object[key], propertyPath, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateArray applies items, minItems and maxItems
+func validateArray(root interface{}, schema map[string]interface{}, array []interface{}, path string) error {
+	if limit, ok := number(schema["minItems"]); ok && float64(len(array)) < limit {
+		return fmt.Errorf("%s: expected at least %v items", path, limit)
+	}
+	if limit, ok := number(schema["maxItems"]); ok && float64(len(array)) > limit {
+		return fmt.Errorf("%s: expected at most %v items", path, limit)
+	}
+
+	if items, ok := schema["items"]; ok {
+		for i, item := range array {
+			if err := validateSchema(root, items, item, fmt.Sprintf("%s[%d]", path, i), nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateString applies minLength, maxLength and pattern
+func validateString(schema map[string]interface{}, s string, path string) error {
+	length := float64(utf8.RuneCountInString(s))
+	if limit, ok := number(schema["minLength"]); ok && length < limit {
+		return fmt.Errorf("%s: expected at least %v characters", path, limit)
+	}
+	if limit, ok := number(schema["maxLength"]); ok && length > limit {
+		return fmt.Errorf("%s: expected at most %v characters", path, limit)
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema pattern at %s: %v", path, err)
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("%s: value does not match pattern %s", path, pattern)
+		}
+	}
+	return nil
+}
+
+// validateNumber applies minimum, maximum and their exclusive variants
+func validateNumber(schema map[string]interface{}, n float64, path string) error {
+	if limit, ok := number(schema["minimum"]); ok && n < limit {
+		return fmt.Errorf("%s: expected a value >= %v", path, limit)
+	}
+	if limit, ok := number(schema["maximum"]); ok && n > limit {
+		return fmt.Errorf("%s: expected a value <= %v", path, limit)
+	}
+	if limit, ok := number(schema["exclusiveMinimum"]); ok && n <= limit {
+		return fmt.Errorf("%s: expected a value > %v", path, limit)
+	}
+	if limit, ok := number(schema["exclusiveMaximum"]); ok && n >= limit {
+		return fmt.Errorf("%s: expected a value < %v", path, limit)
+	}
+	return nil
+}
+
+// checkType checks value against a type keyword, a single type or a list of types
+func checkType(t interface{}, value interface{}, path string) error {
+	var types []string
+	switch tt := t.(type) {
+	case string:
+		types = []string{tt}
+	case []interface{}:
+		for _, name := range tt {
+			if s, ok := name.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+
+	for _, name := range types {
+		if hasType(name, value) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: expected %s", path, strings.Join(types, " or "))
+}
+
+// hasType reports whether value is of the named JSON Schema type
+func hasType(name string, value interface{}) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+// resolveRef resolves a local reference such as "#/$defs/address"
+func resolveRef(root interface{}, ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported schema reference %q", ref)
+	}
+
+	current := root
+	for _, token := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable schema reference %q", ref)
+		}
+		if current, ok = object[token]; !ok {
+			return nil, fmt.Errorf("unresolvable schema reference %q", ref)
+		}
+	}
+	return current, nil
+}
+
+// number returns v as a float64 if it is a JSON number
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
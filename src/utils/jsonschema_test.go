@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateJSONSchema(t *testing.T) {
+	const tree = `{
+		"$defs": {"node": {"type": "object", "properties": {"children": {"type": "array", "items": {"$ref": "#/$defs/node"}}}}},
+		"$ref": "#/$defs/node"
+	}`
+
+	tests := []struct {
+		name    string
+		schema  string
+		data    string
+		wantErr string
+	}{
+		{"type matches", `{"type": "string"}`, `"x"`, ""},
+		{"type mismatch", `{"type": "string"}`, `1`, "$: expected string"},
+		{"integer", `{"type": "integer"}`, `1.5`, "expected integer"},
+		{"required", `{"type": "object", "required": ["a"]}`, `{}`, `missing required property "a"`},
+		{"additional properties", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"b": 1}`, "$.b: not allowed"},
+		{"enum", `{"enum": ["a", "b"]}`, `"c"`, "not one of the allowed values"},
+		{"items", `{"items": {"type": "number"}}`, `[1, "x"]`, "$[1]: expected number"},
+		{"pattern", `{"pattern": "^a+$"}`, `"ab"`, "does not match pattern"},
+		{"range", `{"minimum": 1, "exclusiveMaximum": 3}`, `3`, "expected a value < 3"},
+		{"one of", `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `2`, "matches 2 of oneOf"},
+		{"local ref", `{"$defs": {"n": {"type": "number"}}, "properties": {"a": {"$ref": "#/$defs/n"}}}`, `{"a": "x"}`, "$.a: expected number"},
+		{"recursive ref", tree, `{"children": [{"children": []}]}`, ""},
+		{"recursive ref mismatch", tree, `{"children": [{"children": 1}]}`, "$.children[0].children: expected array"},
+		{"self ref", `{"$ref": "#"}`, `{}`, `cyclic schema reference "#"`},
+		{"ref cycle", `{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "$ref": "#/$defs/a"}`, `1`, "cyclic schema reference"},
+		{"unresolvable ref", `{"$ref": "#/$defs/missing"}`, `1`, "unresolvable schema reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSONSchema([]byte(tt.schema), []byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckJSONSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{"no refs", `{"type": "object"}`, ""},
+		{"recursive through items", `{"$defs": {"list": {"type": "array", "items": {"$ref": "#/$defs/list"}}}, "$ref": "#/$defs/list"}`, ""},
+		{"recursive through properties", `{"properties": {"next": {"$ref": "#"}}}`, ""},
+		{"self ref", `{"$ref": "#"}`, `cyclic schema reference "#"`},
+		{"cycle through anyOf", `{"$defs": {"a": {"anyOf": [{"$ref": "#/$defs/b"}]}, "b": {"$ref": "#/$defs/a"}}}`, "cyclic schema reference"},
+		{"unresolvable ref", `{"properties": {"a": {"$ref": "#/$defs/missing"}}}`, `unresolvable schema reference "#/$defs/missing"`},
+		{"remote ref", `{"$ref": "https://example.com/schema.json"}`, "unsupported schema reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckJSONSchema([]byte(tt.schema))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}